@@ -0,0 +1,353 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: receipt/v1/receipt.proto
+
+package receiptv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Product is a receipt position. Prices are in kopecks.
+type Product struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Quantity      int64                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	UnitPrice     int64                  `protobuf:"varint,3,opt,name=unit_price,json=unitPrice,proto3" json:"unit_price,omitempty"`
+	TotalPrice    int64                  `protobuf:"varint,4,opt,name=total_price,json=totalPrice,proto3" json:"total_price,omitempty"`
+	TaxRate       string                 `protobuf:"bytes,5,opt,name=tax_rate,json=taxRate,proto3" json:"tax_rate,omitempty"`
+	TaxValue      int64                  `protobuf:"varint,6,opt,name=tax_value,json=taxValue,proto3" json:"tax_value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Product) Reset() {
+	*x = Product{}
+	mi := &file_receipt_v1_receipt_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Product) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Product) ProtoMessage() {}
+
+func (x *Product) ProtoReflect() protoreflect.Message {
+	mi := &file_receipt_v1_receipt_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Product.ProtoReflect.Descriptor instead.
+func (*Product) Descriptor() ([]byte, []int) {
+	return file_receipt_v1_receipt_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Product) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Product) GetQuantity() int64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Product) GetUnitPrice() int64 {
+	if x != nil {
+		return x.UnitPrice
+	}
+	return 0
+}
+
+func (x *Product) GetTotalPrice() int64 {
+	if x != nil {
+		return x.TotalPrice
+	}
+	return 0
+}
+
+func (x *Product) GetTaxRate() string {
+	if x != nil {
+		return x.TaxRate
+	}
+	return ""
+}
+
+func (x *Product) GetTaxValue() int64 {
+	if x != nil {
+		return x.TaxValue
+	}
+	return 0
+}
+
+// ReceiptRequested is the protobuf encoding of the receipt event, schema
+// version 1. Field numbers must never be reused.
+type ReceiptRequested struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Uuid   string                 `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Number int64                  `protobuf:"varint,2,opt,name=number,proto3" json:"number,omitempty"`
+	Date   *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=date,proto3" json:"date,omitempty"`
+	// UTC offset of the date in seconds, keeps the local time of the receipt.
+	DateOffset         int32      `protobuf:"varint,4,opt,name=date_offset,json=dateOffset,proto3" json:"date_offset,omitempty"`
+	Organization       string     `protobuf:"bytes,5,opt,name=organization,proto3" json:"organization,omitempty"`
+	PaymentAddress     string     `protobuf:"bytes,6,opt,name=payment_address,json=paymentAddress,proto3" json:"payment_address,omitempty"`
+	TaxpayerNumber     string     `protobuf:"bytes,7,opt,name=taxpayer_number,json=taxpayerNumber,proto3" json:"taxpayer_number,omitempty"`
+	TaxationType       string     `protobuf:"bytes,8,opt,name=taxation_type,json=taxationType,proto3" json:"taxation_type,omitempty"`
+	CalculationSign    string     `protobuf:"bytes,9,opt,name=calculation_sign,json=calculationSign,proto3" json:"calculation_sign,omitempty"`
+	CustomerEmail      string     `protobuf:"bytes,10,opt,name=customer_email,json=customerEmail,proto3" json:"customer_email,omitempty"`
+	FiscalDeviceNumber string     `protobuf:"bytes,11,opt,name=fiscal_device_number,json=fiscalDeviceNumber,proto3" json:"fiscal_device_number,omitempty"`
+	CashRegisterNumber string     `protobuf:"bytes,12,opt,name=cash_register_number,json=cashRegisterNumber,proto3" json:"cash_register_number,omitempty"`
+	FiscalDocument     string     `protobuf:"bytes,13,opt,name=fiscal_document,json=fiscalDocument,proto3" json:"fiscal_document,omitempty"`
+	FiscalAttribute    string     `protobuf:"bytes,14,opt,name=fiscal_attribute,json=fiscalAttribute,proto3" json:"fiscal_attribute,omitempty"`
+	Products           []*Product `protobuf:"bytes,15,rep,name=products,proto3" json:"products,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *ReceiptRequested) Reset() {
+	*x = ReceiptRequested{}
+	mi := &file_receipt_v1_receipt_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReceiptRequested) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReceiptRequested) ProtoMessage() {}
+
+func (x *ReceiptRequested) ProtoReflect() protoreflect.Message {
+	mi := &file_receipt_v1_receipt_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReceiptRequested.ProtoReflect.Descriptor instead.
+func (*ReceiptRequested) Descriptor() ([]byte, []int) {
+	return file_receipt_v1_receipt_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ReceiptRequested) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetNumber() int64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *ReceiptRequested) GetDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Date
+	}
+	return nil
+}
+
+func (x *ReceiptRequested) GetDateOffset() int32 {
+	if x != nil {
+		return x.DateOffset
+	}
+	return 0
+}
+
+func (x *ReceiptRequested) GetOrganization() string {
+	if x != nil {
+		return x.Organization
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetPaymentAddress() string {
+	if x != nil {
+		return x.PaymentAddress
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetTaxpayerNumber() string {
+	if x != nil {
+		return x.TaxpayerNumber
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetTaxationType() string {
+	if x != nil {
+		return x.TaxationType
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetCalculationSign() string {
+	if x != nil {
+		return x.CalculationSign
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetCustomerEmail() string {
+	if x != nil {
+		return x.CustomerEmail
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetFiscalDeviceNumber() string {
+	if x != nil {
+		return x.FiscalDeviceNumber
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetCashRegisterNumber() string {
+	if x != nil {
+		return x.CashRegisterNumber
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetFiscalDocument() string {
+	if x != nil {
+		return x.FiscalDocument
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetFiscalAttribute() string {
+	if x != nil {
+		return x.FiscalAttribute
+	}
+	return ""
+}
+
+func (x *ReceiptRequested) GetProducts() []*Product {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+var File_receipt_v1_receipt_proto protoreflect.FileDescriptor
+
+const file_receipt_v1_receipt_proto_rawDesc = "" +
+	"\n" +
+	"\x18receipt/v1/receipt.proto\x12\n" +
+	"receipt.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xb1\x01\n" +
+	"\aProduct\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x03R\bquantity\x12\x1d\n" +
+	"\n" +
+	"unit_price\x18\x03 \x01(\x03R\tunitPrice\x12\x1f\n" +
+	"\vtotal_price\x18\x04 \x01(\x03R\n" +
+	"totalPrice\x12\x19\n" +
+	"\btax_rate\x18\x05 \x01(\tR\ataxRate\x12\x1b\n" +
+	"\ttax_value\x18\x06 \x01(\x03R\btaxValue\"\xe5\x04\n" +
+	"\x10ReceiptRequested\x12\x12\n" +
+	"\x04uuid\x18\x01 \x01(\tR\x04uuid\x12\x16\n" +
+	"\x06number\x18\x02 \x01(\x03R\x06number\x12.\n" +
+	"\x04date\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04date\x12\x1f\n" +
+	"\vdate_offset\x18\x04 \x01(\x05R\n" +
+	"dateOffset\x12\"\n" +
+	"\forganization\x18\x05 \x01(\tR\forganization\x12'\n" +
+	"\x0fpayment_address\x18\x06 \x01(\tR\x0epaymentAddress\x12'\n" +
+	"\x0ftaxpayer_number\x18\a \x01(\tR\x0etaxpayerNumber\x12#\n" +
+	"\rtaxation_type\x18\b \x01(\tR\ftaxationType\x12)\n" +
+	"\x10calculation_sign\x18\t \x01(\tR\x0fcalculationSign\x12%\n" +
+	"\x0ecustomer_email\x18\n" +
+	" \x01(\tR\rcustomerEmail\x120\n" +
+	"\x14fiscal_device_number\x18\v \x01(\tR\x12fiscalDeviceNumber\x120\n" +
+	"\x14cash_register_number\x18\f \x01(\tR\x12cashRegisterNumber\x12'\n" +
+	"\x0ffiscal_document\x18\r \x01(\tR\x0efiscalDocument\x12)\n" +
+	"\x10fiscal_attribute\x18\x0e \x01(\tR\x0ffiscalAttribute\x12/\n" +
+	"\bproducts\x18\x0f \x03(\v2\x13.receipt.v1.ProductR\bproductsB4Z2github.com/niksmo/receipt/api/receipt/v1;receiptv1b\x06proto3"
+
+var (
+	file_receipt_v1_receipt_proto_rawDescOnce sync.Once
+	file_receipt_v1_receipt_proto_rawDescData []byte
+)
+
+func file_receipt_v1_receipt_proto_rawDescGZIP() []byte {
+	file_receipt_v1_receipt_proto_rawDescOnce.Do(func() {
+		file_receipt_v1_receipt_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_receipt_v1_receipt_proto_rawDesc), len(file_receipt_v1_receipt_proto_rawDesc)))
+	})
+	return file_receipt_v1_receipt_proto_rawDescData
+}
+
+var file_receipt_v1_receipt_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_receipt_v1_receipt_proto_goTypes = []any{
+	(*Product)(nil),               // 0: receipt.v1.Product
+	(*ReceiptRequested)(nil),      // 1: receipt.v1.ReceiptRequested
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_receipt_v1_receipt_proto_depIdxs = []int32{
+	2, // 0: receipt.v1.ReceiptRequested.date:type_name -> google.protobuf.Timestamp
+	0, // 1: receipt.v1.ReceiptRequested.products:type_name -> receipt.v1.Product
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_receipt_v1_receipt_proto_init() }
+func file_receipt_v1_receipt_proto_init() {
+	if File_receipt_v1_receipt_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_receipt_v1_receipt_proto_rawDesc), len(file_receipt_v1_receipt_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_receipt_v1_receipt_proto_goTypes,
+		DependencyIndexes: file_receipt_v1_receipt_proto_depIdxs,
+		MessageInfos:      file_receipt_v1_receipt_proto_msgTypes,
+	}.Build()
+	File_receipt_v1_receipt_proto = out.File
+	file_receipt_v1_receipt_proto_goTypes = nil
+	file_receipt_v1_receipt_proto_depIdxs = nil
+}
@@ -0,0 +1,18 @@
+package receiptv1
+
+import _ "embed"
+
+// ProtoSchema is the source of the receipt protobuf schema, registered in the
+// schema registry for the protobuf encoded records.
+//
+//go:embed receipt.proto
+var ProtoSchema string
+
+// JSONSchema describes the JSON encoded receipt records.
+//
+//go:embed receipt_requested.schema.json
+var JSONSchema string
+
+// ReceiptRequestedIndex is the index of the ReceiptRequested message within
+// receipt.proto, as required by the schema registry wire format.
+const ReceiptRequestedIndex = 1
@@ -0,0 +1,46 @@
+#!/bin/sh
+# Generates the CA and the broker certificates of the SASL_SSL listener of the
+# compose cluster, see compose.secure.yaml. The existing certificates are
+# kept. The clients connect to the listener with:
+#
+#   RECEIPT_SEED_BROKERS=localhost:19095,localhost:29095,localhost:39095
+#   RECEIPT_KAFKA_TLS_CA_FILE=build/kafka/certs/ca.crt
+#   RECEIPT_KAFKA_SASL_MECHANISM=SCRAM-SHA-512
+#   RECEIPT_KAFKA_SASL_USERNAME=receipt
+#   RECEIPT_KAFKA_SASL_PASSWORD=receipt-secret
+#
+# The broker key is readable by the owner and the group only. It is owned by
+# KAFKA_UID:KAFKA_GID, the user of the broker image, if run as root.
+set -eu
+
+: "${KAFKA_UID:=1001}"
+: "${KAFKA_GID:=0}"
+
+dir="$(dirname "$0")/certs"
+mkdir -p "$dir"
+cd "$dir"
+
+if [ -f kafka.keystore.pem ] && [ -f kafka.keystore.key ]; then
+	echo "certificates exist in $dir"
+	exit 0
+fi
+
+umask 077
+openssl req -x509 -newkey rsa:2048 -nodes -days 365 \
+	-subj "/CN=receipt-kafka-ca" -keyout ca.key -out ca.crt
+
+openssl req -newkey rsa:2048 -nodes -subj "/CN=kafka" \
+	-keyout kafka.keystore.key -out kafka.csr
+
+printf 'subjectAltName=DNS:localhost,DNS:kafka-1,DNS:kafka-2,DNS:kafka-3,IP:127.0.0.1\n' > san.ext
+openssl x509 -req -in kafka.csr -CA ca.crt -CAkey ca.key -CAcreateserial \
+	-days 365 -extfile san.ext -out kafka.keystore.pem
+
+cp ca.crt kafka.truststore.pem
+rm kafka.csr san.ext ca.srl
+
+chmod 644 ca.crt kafka.truststore.pem kafka.keystore.pem
+chmod 640 kafka.keystore.key
+if [ "$(id -u)" -eq 0 ]; then
+	chown "$KAFKA_UID:$KAFKA_GID" kafka.keystore.key
+fi
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/niksmo/receipt/config"
+	"github.com/niksmo/receipt/pkg/env"
+	"github.com/niksmo/receipt/pkg/httpserver"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/tracing"
+)
+
+const (
+	defaultLogLevel       = "info"
+	defaultHTTPServerAddr = ":8090" // receipt service listens on :8080
+	defaultNotifierURL    = "http://localhost:7000"
+	defaultTraceExporter  = tracing.ExporterNone
+
+	dlqPartitions        = 1
+	dlqReplicationFactor = -1 // broker default
+)
+
+var defaultSeedBrokers = []string{
+	"localhost:19094", "localhost:29094", "localhost:39094",
+}
+
+// DispatchConfig is the part of the configuration without the custom
+// validation.
+type DispatchConfig struct {
+	OutboxTopic   string          `env:"DISPATCHER_OUTBOX_TOPIC" default:"mail-outbox"`
+	ConsumerGroup string          `env:"DISPATCHER_CONSUMER_GROUP" default:"mail-dispatcher-group"`
+	Balancer      config.Balancer `env:"DISPATCHER_BALANCER" default:"cooperative-sticky" enum:"cooperative-sticky,sticky,range,round-robin"`
+	InstanceID    string          `env:"DISPATCHER_INSTANCE_ID"`
+	SenderEmail   string          `env:"DISPATCHER_SENDER_EMAIL" default:"noreply@receipt.local"`
+	Concurrency   int             `env:"DISPATCHER_CONCURRENCY" default:"8" min:"1"`
+	// RateLimit is unlimited if zero.
+	RateLimit  int `env:"DISPATCHER_RATE_LIMIT" default:"0" min:"0"`
+	RateBurst  int `env:"DISPATCHER_RATE_BURST" default:"1" min:"1"`
+	MaxRetries int `env:"DISPATCHER_MAX_RETRIES" default:"3" min:"0"`
+	// NotifierTimeout bounds every single attempt.
+	NotifierTimeout    time.Duration `env:"DISPATCHER_NOTIFIER_TIMEOUT" default:"5s" min:"1ms"`
+	BreakerThreshold   int           `env:"DISPATCHER_BREAKER_THRESHOLD" default:"5" min:"1"`
+	BreakerOpenTimeout time.Duration `env:"DISPATCHER_BREAKER_OPEN_TIMEOUT" default:"10s" min:"1ms"`
+	DLQTopic           string        `env:"DISPATCHER_DLQ_TOPIC" default:"mail-outbox-dlq"`
+	// DLQRedact masks the customer contacts in the dead letters, the masked
+	// dead letters cannot be replayed.
+	DLQRedact bool `env:"DISPATCHER_DLQ_REDACT" default:"false"`
+	// KeyringFile is required if the receipt service encrypts the mails,
+	// the dead letters are encrypted as well when it is set.
+	KeyringFile string `env:"DISPATCHER_KEYRING_FILE"`
+	// ShutdownTimeout is the deadline for draining the in-flight dispatch.
+	ShutdownTimeout time.Duration `env:"DISPATCHER_SHUTDOWN_TIMEOUT" default:"30s" min:"1ms"`
+}
+
+type AppConfig struct {
+	LogLevel       string
+	HTTPServerAddr string
+	HTTPServer     httpserver.Options
+	SeedBrokers    []string
+	KafkaSecurity  kafkaclient.Security
+	NotifierURL    string `secret:"url"`
+	TraceExporter  string
+	DispatchConfig
+}
+
+func LoadConfig() AppConfig {
+	var errs []error
+	collect := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	logLevel, err := config.LoadLogLevel("DISPATCHER_LOG_LEVEL", defaultLogLevel)
+	collect(err)
+
+	addr, err := config.LoadHTTPServerAddr(
+		"DISPATCHER_HTTP_ADDR", defaultHTTPServerAddr)
+	collect(err)
+
+	httpServerOpts, err := config.LoadHTTPServerOptions("DISPATCHER_")
+	collect(err)
+
+	seedBrokers, err := config.LoadSeedBrokers(
+		"DISPATCHER_SEED_BROKERS", defaultSeedBrokers)
+	collect(err)
+
+	kafkaSecurity, err := config.LoadKafkaSecurity("DISPATCHER_")
+	collect(err)
+
+	notifierURL, err := loadNotifierURL()
+	collect(err)
+
+	traceExporter, err := config.LoadTraceExporter(
+		"DISPATCHER_TRACE_EXPORTER", defaultTraceExporter)
+	collect(err)
+
+	var dispatchCfg DispatchConfig
+	collect(env.Load(&dispatchCfg))
+
+	cfg := AppConfig{
+		LogLevel:       logLevel,
+		HTTPServerAddr: addr,
+		HTTPServer:     httpServerOpts,
+		SeedBrokers:    seedBrokers,
+		KafkaSecurity:  kafkaSecurity,
+		NotifierURL:    notifierURL,
+		TraceExporter:  traceExporter,
+		DispatchConfig: dispatchCfg,
+	}
+
+	collect(config.CheckUnknown())
+	if len(errs) != 0 {
+		panic(errors.Join(errs...))
+	}
+	return cfg
+}
+
+func loadNotifierURL() (string, error) {
+	v, err := env.String(
+		"DISPATCHER_NOTIFIER_URL",
+		func(v string) error {
+			u, err := url.Parse(v)
+			if err != nil {
+				return err
+			}
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return fmt.Errorf("unsupported notifier URL scheme %q", u.Scheme)
+			}
+			return nil
+		},
+	)
+	if errors.Is(err, env.ErrNotSet) {
+		return defaultNotifierURL, nil
+	}
+	return v, err
+}
+
+func OnInitTopicFall(log logger.Logger, stop context.CancelFunc) func(error) {
+	return func(err error) {
+		log.Error().Err(err).Msg("failed to init broker topic")
+		stop()
+	}
+}
+
+func PrintAppTitle() {
+	fmt.Printf(`
++-------------------------------+
+|📬MAIL DISPATCHER APPLICATION🚀|
++-------------------------------+
+`)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/niksmo/receipt/config"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/adapter"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/service"
+	"github.com/niksmo/receipt/pkg/health"
+	"github.com/niksmo/receipt/pkg/httpserver"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/niksmo/receipt/pkg/middleware"
+	"github.com/niksmo/receipt/pkg/sig"
+	"github.com/niksmo/receipt/pkg/tracing"
+)
+
+func main() {
+	opts, err := config.Init("DISPATCHER_", os.Args[1:])
+	if err != nil {
+		panic(err)
+	}
+
+	cfg := LoadConfig()
+	if opts.PrintConfig {
+		if err := config.Fprint(os.Stdout, cfg); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	PrintAppTitle()
+
+	sigCtx, stop := sig.NotifyContext()
+	defer stop()
+
+	log := logger.New(cfg.LogLevel)
+
+	shutdownTracing, err := tracing.Setup(
+		sigCtx, "mail_dispatcher", cfg.TraceExporter)
+	if err != nil {
+		panic(err)
+	}
+
+	notifierClient := adapter.NewNotifierClient(log, adapter.NotifierConfig{
+		URL:                cfg.NotifierURL,
+		SenderEmail:        cfg.SenderEmail,
+		RateLimit:          cfg.RateLimit,
+		RateBurst:          cfg.RateBurst,
+		Timeout:            cfg.NotifierTimeout,
+		BreakerThreshold:   cfg.BreakerThreshold,
+		BreakerOpenTimeout: cfg.BreakerOpenTimeout,
+	})
+
+	keyring, err := config.LoadKeyring(cfg.KeyringFile)
+	if err != nil {
+		panic(err)
+	}
+
+	dlqProducer := adapter.NewKafkaDeadLetterProducer(log, cfg.SeedBrokers,
+		cfg.KafkaSecurity, cfg.DLQTopic, cfg.DLQRedact, keyring)
+
+	dlqProducer.InitTopic(sigCtx, dlqPartitions, dlqReplicationFactor,
+		OnInitTopicFall(log, stop))
+
+	service := service.NewService(log, notifierClient, dlqProducer,
+		adapter.PromMetrics{}, cfg.Concurrency, cfg.MaxRetries)
+
+	kafkaConsumer := adapter.NewKafkaConsumer(log, adapter.ConsumerConfig{
+		SeedBrokers: cfg.SeedBrokers,
+		Topic:       cfg.OutboxTopic,
+		Group:       cfg.ConsumerGroup,
+		InstanceID:  cfg.InstanceID,
+		Balancer:    cfg.Balancer.GroupBalancer(),
+		Security:    cfg.KafkaSecurity,
+		Keyring:     keyring,
+	}, service)
+
+	mux := http.NewServeMux()
+	adapter.RegisterStatsHandler(log, mux, service, kafkaConsumer)
+
+	rootMux := http.NewServeMux()
+	health.New().
+		Add("broker", kafkaConsumer.CheckBroker).
+		Add("outbox_topic", kafkaConsumer.CheckTopic).
+		Add("dlq_topic", dlqProducer.CheckTopic).
+		Add("consumer_group", kafkaConsumer.CheckGroup).
+		Add("notifier", notifierClient.CheckReachable).
+		Register(rootMux)
+	metrics.Register(rootMux)
+	rootMux.Handle("/", metrics.InstrumentHTTP(mux,
+		middleware.RequestID(log, middleware.LogResposeStatus(log,
+			tracing.Middleware(mux, middleware.AcceptJSON(mux))))))
+
+	httpServer, err := httpserver.New(
+		log, cfg.HTTPServerAddr, rootMux, cfg.HTTPServer)
+	if err != nil {
+		panic(err)
+	}
+	go httpServer.Run(stop)
+	go func() {
+		// the consumer stops on the records the keyring cannot decrypt
+		defer stop()
+		kafkaConsumer.Run(sigCtx)
+	}()
+
+	<-sigCtx.Done()
+	shutdown(log, cfg.ShutdownTimeout,
+		httpServer, kafkaConsumer, dlqProducer, shutdownTracing)
+}
+
+type shutdowner interface {
+	Shutdown(ctx context.Context)
+}
+
+// shutdown stops accepting the requests, drains the in-flight dispatch,
+// flushes the dead letters it produced and then the traces, all within the
+// timeout.
+func shutdown(
+	log logger.Logger,
+	timeout time.Duration,
+	httpServer, consumer, dlqProducer shutdowner,
+	shutdownTracing func(context.Context) error,
+) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	httpServer.Shutdown(ctx)
+	consumer.Shutdown(ctx)
+	dlqProducer.Shutdown(ctx)
+	tracing.Flush(ctx, log, shutdownTracing)
+}
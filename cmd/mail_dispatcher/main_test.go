@@ -0,0 +1,69 @@
+//go:build !integration
+
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type shutdownLog struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (l *shutdownLog) add(step string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.steps = append(l.steps, step)
+}
+
+// fakeShutdowner records its shutdown and takes the delay unless the
+// context is done first.
+type fakeShutdowner struct {
+	name  string
+	log   *shutdownLog
+	delay time.Duration
+}
+
+func (s fakeShutdowner) Shutdown(ctx context.Context) {
+	select {
+	case <-time.After(s.delay):
+		s.log.add(s.name)
+	case <-ctx.Done():
+		s.log.add(s.name + ":deadline")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		var l shutdownLog
+		shutdown(logger.New("disabled"), time.Second,
+			fakeShutdowner{"http", &l, 0},
+			fakeShutdowner{"consumer", &l, 50 * time.Millisecond},
+			fakeShutdowner{"dlq", &l, 0},
+			func(context.Context) error { l.add("traces"); return nil },
+		)
+		assert.Equal(t, []string{"http", "consumer", "dlq", "traces"}, l.steps)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		var l shutdownLog
+		start := time.Now()
+		shutdown(logger.New("disabled"), 50*time.Millisecond,
+			fakeShutdowner{"http", &l, 0},
+			fakeShutdowner{"consumer", &l, time.Hour},
+			fakeShutdowner{"dlq", &l, time.Hour},
+			func(ctx context.Context) error { l.add("traces"); return ctx.Err() },
+		)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, []string{
+			"http", "consumer:deadline", "dlq:deadline", "traces",
+		}, l.steps)
+	})
+}
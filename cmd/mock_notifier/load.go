@@ -3,56 +3,59 @@ package main
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/niksmo/receipt/config"
-	"github.com/niksmo/receipt/pkg/env"
+	"github.com/niksmo/receipt/pkg/httpserver"
+	"github.com/niksmo/receipt/pkg/tracing"
 )
 
 const (
 	defaultLogLevel       = "info"
 	defaultHTTPServerAddr = ":8080"
 	defaultRateLimit      = 1000 // RPS
+	defaultTraceExporter  = tracing.ExporterNone
+	traceFlushTimeout     = 5 * time.Second
 )
 
 type AppConfig struct {
 	LogLevel       string
 	HTTPServerAddr string
+	HTTPServer     httpserver.Options
 	RateLimit      int
+	TraceExporter  string
 }
 
 func LoadConfig() AppConfig {
-	logLevel := config.LoadLogLevel("NOTIFIER_LOG_LEVEL", defaultLogLevel)
-
-	addr, err := config.LoadHTTPServerAddr("NOTIFIER_HTTP_ADDR", defaultHTTPServerAddr)
-	if err != nil {
-		panic(err)
+	var errs []error
+	collect := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	rateLimit := loadRateLimit()
+	logLevel, err := config.LoadLogLevel("NOTIFIER_LOG_LEVEL", defaultLogLevel)
+	collect(err)
 
-	return AppConfig{logLevel, addr, rateLimit}
-}
+	addr, err := config.LoadHTTPServerAddr("NOTIFIER_HTTP_ADDR", defaultHTTPServerAddr)
+	collect(err)
 
-func (c AppConfig) Print() {
-	fmt.Printf(
-		`Configuration:
-LogLevel:          %q
-HTTPServerAddress: %q
-RateLimit:        % d
+	httpServerOpts, err := config.LoadHTTPServerOptions("NOTIFIER_")
+	collect(err)
 
-`,
-		c.LogLevel,
-		c.HTTPServerAddr,
-		c.RateLimit,
-	)
-}
+	rateLimit, err := config.LoadMinInt(
+		"NOTIFIER_RATE_LIMIT", defaultRateLimit, 1)
+	collect(err)
+
+	traceExporter, err := config.LoadTraceExporter(
+		"NOTIFIER_TRACE_EXPORTER", defaultTraceExporter)
+	collect(err)
 
-func loadRateLimit() int {
-	rateLimit, err := env.Int("NOTIFIER_RATE_LIMIT", nil)
-	if errors.Is(err, env.ErrNotSet) {
-		rateLimit = defaultRateLimit
+	collect(config.CheckUnknown())
+	if len(errs) != 0 {
+		panic(errors.Join(errs...))
 	}
-	return rateLimit
+	return AppConfig{logLevel, addr, httpServerOpts, rateLimit, traceExporter}
 }
 
 func PrintAppTitle() {
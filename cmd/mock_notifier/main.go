@@ -1,36 +1,72 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os"
 
+	"github.com/niksmo/receipt/config"
 	"github.com/niksmo/receipt/internal/mock_notifier/adapter"
 	"github.com/niksmo/receipt/internal/mock_notifier/core/service"
+	"github.com/niksmo/receipt/pkg/health"
 	"github.com/niksmo/receipt/pkg/httpserver"
 	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
 	"github.com/niksmo/receipt/pkg/middleware"
 	"github.com/niksmo/receipt/pkg/sig"
+	"github.com/niksmo/receipt/pkg/tracing"
 )
 
 func main() {
-	PrintAppTitle()
+	opts, err := config.Init("NOTIFIER_", os.Args[1:])
+	if err != nil {
+		panic(err)
+	}
 
 	cfg := LoadConfig()
-	cfg.Print()
+	if opts.PrintConfig {
+		if err := config.Fprint(os.Stdout, cfg); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	PrintAppTitle()
 
 	sigCtx, stop := sig.NotifyContext()
 	defer stop()
 
 	log := logger.New(cfg.LogLevel)
 
+	shutdownTracing, err := tracing.Setup(
+		sigCtx, "mock_notifier", cfg.TraceExporter)
+	if err != nil {
+		panic(err)
+	}
+
 	service := service.NewService(log)
 
 	mux := http.NewServeMux()
 	adapter.RegisterSendMailHandler(log, mux, service, cfg.RateLimit)
 
-	handler := middleware.LogResposeStatus(log, middleware.AcceptJSON(mux))
-	httpServer := httpserver.New(log, cfg.HTTPServerAddr, handler)
+	rootMux := http.NewServeMux()
+	health.New().Register(rootMux)
+	metrics.Register(rootMux)
+	rootMux.Handle("/", metrics.InstrumentHTTP(mux,
+		middleware.RequestID(log, middleware.LogResposeStatus(log,
+			tracing.Middleware(mux, middleware.AcceptJSON(mux))))))
+
+	httpServer, err := httpserver.New(
+		log, cfg.HTTPServerAddr, rootMux, cfg.HTTPServer)
+	if err != nil {
+		panic(err)
+	}
 	go httpServer.Run(stop)
 
 	<-sigCtx.Done()
 	httpServer.Close()
+	flushCtx, cancel := context.WithTimeout(
+		context.Background(), traceFlushTimeout)
+	defer cancel()
+	tracing.Flush(flushCtx, log, shutdownTracing)
 }
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/url"
 
 	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/schemaregistry"
 )
 
 func OnInitTopicFall(log logger.Logger, stop context.CancelFunc) func(error) {
@@ -14,6 +16,18 @@ func OnInitTopicFall(log logger.Logger, stop context.CancelFunc) func(error) {
 	}
 }
 
+// NewSchemaRegistry returns nil if the registry URL is not set.
+func NewSchemaRegistry(u *url.URL) schemaregistry.Registry {
+	switch {
+	case u == nil:
+		return nil
+	case u.Scheme == "memory":
+		return schemaregistry.NewMemoryRegistry()
+	default:
+		return schemaregistry.NewHTTPRegistry(u.String())
+	}
+}
+
 func PrintAppTitle() {
 	fmt.Printf(`
 +-----------------------+
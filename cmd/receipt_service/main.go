@@ -1,48 +1,121 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os"
 
 	"github.com/niksmo/receipt/config"
 	"github.com/niksmo/receipt/internal/receipt_service/adapter"
 	"github.com/niksmo/receipt/internal/receipt_service/core/service"
+	"github.com/niksmo/receipt/pkg/health"
 	"github.com/niksmo/receipt/pkg/httpserver"
 	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
 	"github.com/niksmo/receipt/pkg/middleware"
 	"github.com/niksmo/receipt/pkg/sig"
+	"github.com/niksmo/receipt/pkg/tracing"
 )
 
 func main() {
-	PrintAppTitle()
+	opts, err := config.Init("RECEIPT_", os.Args[1:])
+	if err != nil {
+		panic(err)
+	}
+
 	cfg := config.LoadConfig()
-	cfg.Print()
+	if opts.PrintConfig {
+		if err := config.Fprint(os.Stdout, cfg); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	PrintAppTitle()
 
 	log := logger.New(cfg.LogLevel)
 
 	sigCtx, stop := sig.NotifyContext()
 	defer stop()
 
+	shutdownTracing, err := tracing.Setup(
+		sigCtx, "receipt_service", cfg.TraceExporter)
+	if err != nil {
+		panic(err)
+	}
+
+	statusStore := adapter.NewMemoryStatusStore()
+
+	schemaRegistry := NewSchemaRegistry(cfg.SchemaRegistryURL)
+
+	keyring, err := config.LoadKeyring(cfg.KeyringFile)
+	if err != nil {
+		panic(err)
+	}
+
 	kafkaProducer := adapter.NewKafkaProducer(
-		log, cfg.SeedBrokers, cfg.Topic)
+		log, cfg.BrokerConfig, statusStore, schemaRegistry, keyring)
 
 	kafkaProducer.InitTopic(sigCtx, cfg.Partitions,
 		cfg.ReplicationFactor, OnInitTopicFall(log, stop))
 
-	service := service.NewService(log, kafkaProducer)
+	service := service.NewService(log, kafkaProducer, statusStore,
+		adapter.PromMetrics{}, cfg.ProduceTimeout, cfg.BatchProduceTimeout)
 
 	kafkaConsumer := adapter.NewKafkaConsumer(
-		log, cfg.SeedBrokers, cfg.Topic, cfg.ConsumerGroup, service)
+		log, cfg.BrokerConfig, service, schemaRegistry, keyring)
+
+	kafkaConsumer.InitOutboxTopic(sigCtx, cfg.Partitions,
+		cfg.ReplicationFactor, OnInitTopicFall(log, stop))
+
+	lagMonitor := adapter.NewLagMonitor(log, adapter.LagMonitorConfig{
+		SeedBrokers:  cfg.SeedBrokers,
+		Security:     cfg.Security,
+		Group:        cfg.ConsumerGroup,
+		Topic:        cfg.Topic,
+		Interval:     cfg.LagMonitor.Interval,
+		LagThreshold: cfg.LagMonitor.LagThreshold,
+		AgeThreshold: cfg.LagMonitor.AgeThreshold,
+	})
 
 	mux := http.NewServeMux()
-	adapter.RegisterMailReceiptHandler(log, mux, service)
+	adapter.RegisterMailReceiptHandler(
+		log, mux, service, cfg.BatchMaxSize, cfg.AsyncProduce())
+	adapter.RegisterReceiptStatusHandler(log, mux, service)
+	adapter.RegisterLagHandler(log, mux, lagMonitor, cfg.AdminToken)
+
+	rootMux := http.NewServeMux()
+	health.New().
+		Add("broker", kafkaProducer.CheckBroker).
+		Add("topic", kafkaProducer.CheckTopic).
+		Add("outbox_topic", kafkaConsumer.CheckOutboxTopic).
+		Add("consumer_group", kafkaConsumer.CheckGroup).
+		Register(rootMux)
+	metrics.Register(rootMux)
+	rootMux.Handle("/", metrics.InstrumentHTTP(mux,
+		middleware.RequestID(log, middleware.LogResposeStatus(log,
+			tracing.Middleware(mux, middleware.AcceptJSON(mux, adapter.BatchPath))))))
 
-	httpHandler := middleware.LogResposeStatus(log, middleware.AcceptJSON(mux))
-	httpServer := httpserver.New(log, cfg.HTTPServerAddr, httpHandler)
+	httpServer, err := httpserver.New(
+		log, cfg.HTTPServerAddr, rootMux, cfg.HTTPServer)
+	if err != nil {
+		panic(err)
+	}
 	go httpServer.Run(stop)
-	go kafkaConsumer.Run(sigCtx)
+	go func() {
+		// the consumer stops on the records the keyring cannot decrypt
+		defer stop()
+		kafkaConsumer.Run(sigCtx)
+	}()
+	go lagMonitor.Run(sigCtx)
 
 	<-sigCtx.Done()
-	httpServer.Close()
-	kafkaProducer.Close()
-	kafkaConsumer.Close()
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+	kafkaProducer.Shutdown(shutdownCtx)
+	kafkaConsumer.Shutdown(shutdownCtx)
+	lagMonitor.Close()
+	tracing.Flush(shutdownCtx, log, shutdownTracing)
 }
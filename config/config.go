@@ -4,94 +4,222 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
+	"time"
 
 	"github.com/niksmo/receipt/pkg/env"
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/niksmo/receipt/pkg/httpserver"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/tracing"
+	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 const (
 	defaultLogLevel       = "info"
 	defaultHTTPServerAddr = ":8080"
+	defaultTraceExporter  = tracing.ExporterNone
+)
+
+type ProduceMode string
+
+const (
+	ProduceModeSync  ProduceMode = "sync"
+	ProduceModeAsync ProduceMode = "async"
+)
+
+// KeyStrategy defines which receipt field is used as the Kafka record key.
+// Records with the same key are always produced to the same partition.
+type KeyStrategy string
+
+const (
+	KeyStrategyCashRegister  KeyStrategy = "cash_register"
+	KeyStrategyINN           KeyStrategy = "inn"
+	KeyStrategyCustomerEmail KeyStrategy = "customer_email"
+	KeyStrategyUUID          KeyStrategy = "uuid"
+)
 
-	defaultTopic         = "mail-receipt"
-	minPartitions        = 1
-	minReplicationFactor = -1
+// Codec defines the encoding of produced receipt records. The consumer
+// decodes records of any supported codec.
+type Codec string
 
-	defaultConsumerGroup = "mail-group"
+const (
+	CodecJSON     Codec = "json"
+	CodecProtobuf Codec = "protobuf"
+)
+
+// Balancer defines how the partitions are assigned to the consumer group
+// members. The cooperative sticky balancer revokes only the partitions that
+// move to another member.
+type Balancer string
+
+const (
+	BalancerCooperativeSticky Balancer = "cooperative-sticky"
+	BalancerSticky            Balancer = "sticky"
+	BalancerRange             Balancer = "range"
+	BalancerRoundRobin        Balancer = "round-robin"
 )
 
+// GroupBalancer returns the client balancer.
+func (b Balancer) GroupBalancer() kgo.GroupBalancer {
+	switch b {
+	case BalancerSticky:
+		return kgo.StickyBalancer()
+	case BalancerRange:
+		return kgo.RangeBalancer()
+	case BalancerRoundRobin:
+		return kgo.RoundRobinBalancer()
+	default:
+		return kgo.CooperativeStickyBalancer()
+	}
+}
+
 var (
 	defaultSeedBrokers = []string{
 		"localhost:19094", "localhost:29094", "localhost:39094",
 	}
 )
 
+// BrokerConfig is loaded with the "RECEIPT_" prefix, the seed brokers are
+// resolved on load.
 type BrokerConfig struct {
 	SeedBrokers       []string
-	Topic             string
-	Partitions        int
-	ReplicationFactor int
-	ConsumerGroup     string
+	Topic             string   `env:"TOPIC" default:"mail-receipt"`
+	Partitions        int      `env:"PARTITIONS" default:"1" min:"1"`
+	ReplicationFactor int      `env:"REPLICATION_FACTOR" default:"-1" min:"-1"`
+	ConsumerGroup     string   `env:"CONSUMER_GROUP" default:"mail-group"`
+	Balancer          Balancer `env:"BALANCER" default:"cooperative-sticky" enum:"cooperative-sticky,sticky,range,round-robin"`
+	// InstanceID enables the static group membership when set, it must be
+	// unique for each running service instance.
+	InstanceID         string      `env:"INSTANCE_ID"`
+	ProduceMode        ProduceMode `env:"PRODUCE_MODE" default:"sync" enum:"sync,async"`
+	MaxBufferedRecords int         `env:"MAX_BUFFERED_RECORDS" default:"10000" min:"1"`
+	KeyStrategy        KeyStrategy `env:"KEY_STRATEGY" default:"cash_register" enum:"cash_register,inn,customer_email,uuid"`
+	Codec              Codec       `env:"CODEC" default:"json" enum:"json,protobuf"`
+	// SchemaRegistryURL enables the schema registry wire format when set.
+	// The "memory" scheme selects the in-process registry, e.g.
+	// "memory://local".
+	SchemaRegistryURL *url.URL `env:"SCHEMA_REGISTRY_URL" secret:"url"`
+	// KeyringFile enables the encryption of the customer contacts on the
+	// topic when set.
+	KeyringFile string `env:"KEYRING_FILE"`
+	OutboxTopic string `env:"OUTBOX_TOPIC" default:"mail-outbox"`
+	// TransactionalID must be unique for each running service instance.
+	TransactionalID string `env:"TRANSACTIONAL_ID" default:"receipt-service"`
+	Security        kafkaclient.Security
+}
+
+// AsyncProduce reports whether the receipts are acknowledged once they are
+// buffered instead of once the broker has them.
+func (c BrokerConfig) AsyncProduce() bool {
+	return c.ProduceMode == ProduceModeAsync
+}
+
+// LagMonitorConfig sets how often the consumer group lag is observed and
+// the thresholds a warning is logged above.
+type LagMonitorConfig struct {
+	Interval     time.Duration `env:"RECEIPT_LAG_INTERVAL" default:"30s" min:"1ms"`
+	LagThreshold int64         `env:"RECEIPT_LAG_THRESHOLD" default:"1000" min:"1"`
+	AgeThreshold time.Duration `env:"RECEIPT_LAG_AGE_THRESHOLD" default:"5m" min:"1ms"`
+}
+
+// ServiceConfig is the part of the configuration without the custom
+// validation.
+type ServiceConfig struct {
+	BatchMaxSize int `env:"RECEIPT_BATCH_MAX_SIZE" default:"500" min:"1"`
+	// ShutdownTimeout is the deadline for draining the in-flight work.
+	ShutdownTimeout time.Duration `env:"RECEIPT_SHUTDOWN_TIMEOUT" default:"30s" min:"1ms"`
+	// ProduceTimeout bounds producing a single receipt.
+	ProduceTimeout time.Duration `env:"RECEIPT_PRODUCE_TIMEOUT" default:"3s" min:"1ms"`
+	// BatchProduceTimeout bounds producing the receipts of a batch request.
+	// It should be less than the HTTP handler timeout for the per-receipt
+	// errors to be answered.
+	BatchProduceTimeout time.Duration `env:"RECEIPT_BATCH_PRODUCE_TIMEOUT" default:"4s" min:"1ms"`
+	// AdminToken authorizes the admin routes, they are disabled if empty.
+	AdminToken string `env:"RECEIPT_ADMIN_TOKEN" secret:"true"`
 }
 
 type Config struct {
 	LogLevel       string
 	HTTPServerAddr string
+	TraceExporter  string
+	HTTPServer     httpserver.Options
+	LagMonitor     LagMonitorConfig
+	ServiceConfig
 	BrokerConfig
 }
 
+// LoadConfig loads the configuration from the sources set up by Init and
+// panics reporting every invalid value.
 func LoadConfig() Config {
 	var errs []error
 
+	logLevel, err := loadLogLevel()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	httpSrvAddr, err := loadHTTPServerAddr()
 	if err != nil {
 		errs = append(errs, err)
 	}
 
+	var serviceCfg ServiceConfig
+	if err := env.Load(&serviceCfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	httpServerOpts, err := LoadHTTPServerOptions("RECEIPT_")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	traceExporter, err := LoadTraceExporter(
+		"RECEIPT_TRACE_EXPORTER", defaultTraceExporter)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	var lagMonitorCfg LagMonitorConfig
+	if err := env.Load(&lagMonitorCfg); err != nil {
+		errs = append(errs, err)
+	}
+
 	brokerCfg, err := loadBrokerConfig()
 	if err != nil {
 		errs = append(errs, err)
 	}
 
+	if err := CheckUnknown(); err != nil {
+		errs = append(errs, err)
+	}
+
 	if errsOnLoad(errs) {
 		panic(errors.Join(errs...))
 	}
 
 	cfg := Config{
-		LogLevel:       loadLogLevel(),
+		LogLevel:       logLevel,
 		HTTPServerAddr: httpSrvAddr,
+		HTTPServer:     httpServerOpts,
+		TraceExporter:  traceExporter,
+		LagMonitor:     lagMonitorCfg,
+		ServiceConfig:  serviceCfg,
 		BrokerConfig:   brokerCfg,
 	}
 	return cfg
 }
 
-func (c Config) Print() {
-	fmt.Printf(
-		`Configuration:
-LogLevel:          %q
-HTTPServerAddress: %q
-SeedBrokers:       %q
-Topic:             %q
-Partitions:        % d
-ReplicationFactor: % d
-ConsumerGroup:     %q
-
-`,
-		c.LogLevel,
-		c.HTTPServerAddr,
-		c.SeedBrokers,
-		c.Topic,
-		c.Partitions,
-		c.ReplicationFactor,
-		c.ConsumerGroup,
-	)
-}
-
-func LoadLogLevel(envValue string, defaultValue string) string {
-	logLevel, err := env.String(envValue, nil)
-	if errors.Is(err, env.ErrNotSet) {
-		return defaultValue
+func LoadLogLevel(envValue string, defaultValue string) (string, error) {
+	logLevel, err := env.String(envValue, logger.ValidateLevel)
+	if err != nil {
+		if errors.Is(err, env.ErrNotSet) {
+			return defaultValue, nil
+		}
+		return "", err
 	}
-	return logLevel
+	return logLevel, nil
 }
 
 func LoadHTTPServerAddr(envValue string, defaultValue string) (string, error) {
@@ -112,7 +240,51 @@ func LoadHTTPServerAddr(envValue string, defaultValue string) (string, error) {
 	return httpSrvAddr, nil
 }
 
-func loadLogLevel() string {
+// LoadKafkaSecurity loads the security of the env variables with the prefix,
+// e.g. RECEIPT_KAFKA_SASL_MECHANISM.
+func LoadKafkaSecurity(prefix string) (kafkaclient.Security, error) {
+	var sec kafkaclient.Security
+	if err := env.LoadPrefix(prefix, &sec); err != nil {
+		return kafkaclient.Security{}, err
+	}
+	if err := sec.Validate(); err != nil {
+		return kafkaclient.Security{}, err
+	}
+	return sec, nil
+}
+
+// LoadHTTPServerOptions loads the options of the env variables with the
+// prefix, e.g. RECEIPT_HTTP_READ_TIMEOUT.
+func LoadHTTPServerOptions(prefix string) (httpserver.Options, error) {
+	var opts httpserver.Options
+	if err := env.LoadPrefix(prefix, &opts); err != nil {
+		return httpserver.Options{}, err
+	}
+	return opts, nil
+}
+
+func LoadTraceExporter(envValue string, defaultValue string) (string, error) {
+	v, err := env.String(
+		envValue,
+		func(v string) error {
+			switch v {
+			case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+				return nil
+			}
+			return fmt.Errorf("invalid trace exporter: %q", v)
+		},
+	)
+
+	if err != nil {
+		if errors.Is(err, env.ErrNotSet) {
+			return defaultValue, nil
+		}
+		return "", err
+	}
+	return v, nil
+}
+
+func loadLogLevel() (string, error) {
 	return LoadLogLevel("RECEIPT_LOG_LEVEL", defaultLogLevel)
 }
 
@@ -123,29 +295,36 @@ func loadHTTPServerAddr() (string, error) {
 func loadBrokerConfig() (BrokerConfig, error) {
 	var errs []error
 
+	var brokerCfg BrokerConfig
+	if err := env.LoadPrefix("RECEIPT_", &brokerCfg); err != nil {
+		errs = append(errs, err)
+	}
+
 	seedBrokers, err := loadSeedBrokers()
 	if err != nil {
 		errs = append(errs, err)
 	}
+	brokerCfg.SeedBrokers = seedBrokers
 
-	if errsOnLoad(errs) {
-		return BrokerConfig{}, errors.Join(errs...)
+	if err := validateSchemaRegistryURL(brokerCfg.SchemaRegistryURL); err != nil {
+		errs = append(errs, err)
 	}
 
-	brokerCfg := BrokerConfig{
-		SeedBrokers:       seedBrokers,
-		Topic:             loadTopic(),
-		Partitions:        loadPartitions(),
-		ReplicationFactor: loadReplicationFactor(),
-		ConsumerGroup:     loadConsumerGroup(),
+	if err := brokerCfg.Security.Validate(); err != nil {
+		errs = append(errs, err)
 	}
 
+	if errsOnLoad(errs) {
+		return BrokerConfig{}, errors.Join(errs...)
+	}
 	return brokerCfg, nil
 }
 
-func loadSeedBrokers() ([]string, error) {
+func LoadSeedBrokers(
+	envValue string, defaultValue []string,
+) ([]string, error) {
 	v, err := env.StringS(
-		"RECEIPT_SEED_BROKERS",
+		envValue,
 		func(v []string) error {
 			for _, brokerAddr := range v {
 				_, err := net.ResolveTCPAddr("tcp", brokerAddr)
@@ -159,7 +338,7 @@ func loadSeedBrokers() ([]string, error) {
 
 	if err != nil {
 		if errors.Is(err, env.ErrNotSet) {
-			return defaultSeedBrokers, nil
+			return defaultValue, nil
 		}
 		return nil, err
 	}
@@ -167,55 +346,51 @@ func loadSeedBrokers() ([]string, error) {
 	return v, nil
 }
 
-func loadTopic() string {
-	v, err := env.String("RECEIPT_TOPIC", nil)
-	if errors.Is(err, env.ErrNotSet) {
-		return defaultTopic
-	}
-	return v
+func loadSeedBrokers() ([]string, error) {
+	return LoadSeedBrokers("RECEIPT_SEED_BROKERS", defaultSeedBrokers)
 }
 
-func loadPartitions() int {
-	v, err := env.Int(
-		"RECEIPT_PARTITIONS",
-		func(v int) error {
-			if v < minPartitions {
-				return errors.New("invalid number of partitions")
-			}
-			return nil
-		},
-	)
-
-	if err != nil {
-		return minPartitions
+// LoadKeyring loads the field encryption keyring, it returns nil if the
+// keyring file is not set.
+func LoadKeyring(path string) (*fieldcrypt.Keyring, error) {
+	if path == "" {
+		return nil, nil
 	}
+	return fieldcrypt.LoadKeyring(path)
+}
 
-	return v
+func validateSchemaRegistryURL(u *url.URL) error {
+	if u == nil {
+		return nil
+	}
+	switch u.Scheme {
+	case "http", "https", "memory":
+		return nil
+	}
+	return fmt.Errorf(
+		"env RECEIPT_SCHEMA_REGISTRY_URL invalid scheme: %q", u.Scheme)
 }
 
-func loadReplicationFactor() int {
+// LoadMinInt returns the default value if the variable is not set and an
+// error if the value is less than the min value.
+func LoadMinInt(name string, defaultValue int, minValue int) (int, error) {
 	v, err := env.Int(
-		"RECEIPT_REPLICATION_FACTOR",
+		name,
 		func(v int) error {
-			if v < minReplicationFactor {
-				return errors.New("invalid replication factor")
+			if v < minValue {
+				return fmt.Errorf("invalid %s: %d is less than %d", name, v, minValue)
 			}
 			return nil
 		},
 	)
-	if err != nil {
-		return minReplicationFactor
-	}
 
-	return v
-}
-
-func loadConsumerGroup() string {
-	v, err := env.String("RECEIPT_CONSUMER_GROUP", nil)
-	if errors.Is(err, env.ErrNotSet) {
-		return defaultConsumerGroup
+	if err != nil {
+		if errors.Is(err, env.ErrNotSet) {
+			return defaultValue, nil
+		}
+		return 0, err
 	}
-	return v
+	return v, nil
 }
 
 func errsOnLoad(errs []error) bool {
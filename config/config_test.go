@@ -2,7 +2,10 @@ package config
 
 import (
 	"testing"
+	"time"
 
+	"github.com/niksmo/receipt/pkg/env"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -12,38 +15,154 @@ func TestLoadConfig(t *testing.T) {
 		config := LoadConfig()
 		assert.Equal(t, defaultLogLevel, config.LogLevel)
 		assert.Equal(t, defaultHTTPServerAddr, config.HTTPServerAddr)
+		assert.Equal(t, 500, config.BatchMaxSize)
+		assert.Equal(t, 30*time.Second, config.ShutdownTimeout)
+		assert.Equal(t, defaultTraceExporter, config.TraceExporter)
+		assert.Equal(t, 3*time.Second, config.ProduceTimeout)
+		assert.Equal(t, 4*time.Second, config.BatchProduceTimeout)
+		assert.Equal(t, 5*time.Second, config.HTTPServer.HandlerTimeout)
+		assert.Equal(t, env.Bytes(4<<20), config.HTTPServer.MaxBodyBytes)
+		assert.True(t, config.HTTPServer.HTTP2)
+		assert.False(t, config.HTTPServer.H2C)
+		assert.False(t, config.HTTPServer.TLS.Enabled())
+		assert.Equal(t, 30*time.Second, config.LagMonitor.Interval)
+		assert.Equal(t, int64(1000), config.LagMonitor.LagThreshold)
+		assert.Equal(t, 5*time.Minute, config.LagMonitor.AgeThreshold)
+		assert.Empty(t, config.AdminToken)
 		assert.Equal(t, defaultSeedBrokers, config.BrokerConfig.SeedBrokers)
-		assert.Equal(t, defaultTopic, config.BrokerConfig.Topic)
-		assert.Equal(t, minPartitions, config.BrokerConfig.Partitions)
-		assert.Equal(t, minReplicationFactor, config.BrokerConfig.ReplicationFactor)
-		assert.Equal(t, defaultConsumerGroup, config.BrokerConfig.ConsumerGroup)
+		assert.Equal(t, "mail-receipt", config.BrokerConfig.Topic)
+		assert.Equal(t, 1, config.BrokerConfig.Partitions)
+		assert.Equal(t, -1, config.BrokerConfig.ReplicationFactor)
+		assert.Equal(t, "mail-group", config.BrokerConfig.ConsumerGroup)
+		assert.Equal(t, BalancerCooperativeSticky, config.BrokerConfig.Balancer)
+		assert.Empty(t, config.BrokerConfig.InstanceID)
+		assert.False(t, config.BrokerConfig.AsyncProduce())
+		assert.Equal(t, 10_000, config.BrokerConfig.MaxBufferedRecords)
+		assert.Equal(t, KeyStrategyCashRegister, config.BrokerConfig.KeyStrategy)
+		assert.Equal(t, CodecJSON, config.BrokerConfig.Codec)
+		assert.Nil(t, config.BrokerConfig.SchemaRegistryURL)
+		assert.Empty(t, config.BrokerConfig.KeyringFile)
+		assert.Equal(t, kafkaclient.Security{}, config.BrokerConfig.Security)
+		assert.Equal(t, "mail-outbox", config.BrokerConfig.OutboxTopic)
+		assert.Equal(t, "receipt-service", config.BrokerConfig.TransactionalID)
 	})
 
 	t.Run("should_set_values", func(t *testing.T) {
-		t.Setenv("RECEIPT_LOG_LEVEL", "myLevel")
+		t.Setenv("RECEIPT_LOG_LEVEL", "debug")
 		t.Setenv("RECEIPT_HTTP_ADDR", "127.0.0.1:4000")
+		t.Setenv("RECEIPT_BATCH_MAX_SIZE", "100")
+		t.Setenv("RECEIPT_SHUTDOWN_TIMEOUT", "5s")
+		t.Setenv("RECEIPT_PRODUCE_TIMEOUT", "1s")
+		t.Setenv("RECEIPT_BATCH_PRODUCE_TIMEOUT", "3s")
+		t.Setenv("RECEIPT_HTTP_HANDLER_TIMEOUT", "2s")
+		t.Setenv("RECEIPT_HTTP_MAX_BODY_BYTES", "200KiB")
+		t.Setenv("RECEIPT_HTTP2", "false")
+		t.Setenv("RECEIPT_HTTP_H2C", "true")
+		t.Setenv("RECEIPT_TLS_CERT_FILE", "/etc/receipt/tls.crt")
+		t.Setenv("RECEIPT_TRACE_EXPORTER", "otlp")
+		t.Setenv("RECEIPT_LAG_INTERVAL", "10s")
+		t.Setenv("RECEIPT_LAG_THRESHOLD", "50")
+		t.Setenv("RECEIPT_LAG_AGE_THRESHOLD", "1m")
+		t.Setenv("RECEIPT_ADMIN_TOKEN", "admin-token")
 		t.Setenv("RECEIPT_SEED_BROKERS", "localhost:3001,localhost:3002")
 		t.Setenv("RECEIPT_TOPIC", "myTopic")
 		t.Setenv("RECEIPT_PARTITIONS", "8")
 		t.Setenv("RECEIPT_REPLICATION_FACTOR", "3")
 		t.Setenv("RECEIPT_CONSUMER_GROUP", "myGroup")
+		t.Setenv("RECEIPT_BALANCER", "range")
+		t.Setenv("RECEIPT_INSTANCE_ID", "receipt-1")
+		t.Setenv("RECEIPT_PRODUCE_MODE", "async")
+		t.Setenv("RECEIPT_MAX_BUFFERED_RECORDS", "1000")
+		t.Setenv("RECEIPT_KEY_STRATEGY", "inn")
+		t.Setenv("RECEIPT_CODEC", "protobuf")
+		t.Setenv("RECEIPT_SCHEMA_REGISTRY_URL", "http://localhost:8081")
+		t.Setenv("RECEIPT_KEYRING_FILE", "/etc/receipt/keyring.json")
+		t.Setenv("RECEIPT_OUTBOX_TOPIC", "myOutbox")
+		t.Setenv("RECEIPT_KAFKA_TLS", "true")
+		t.Setenv("RECEIPT_KAFKA_SASL_MECHANISM", "SCRAM-SHA-256")
+		t.Setenv("RECEIPT_KAFKA_SASL_USERNAME", "receipt")
+		t.Setenv("RECEIPT_KAFKA_SASL_PASSWORD", "secret")
+		t.Setenv("RECEIPT_TRANSACTIONAL_ID", "myTxID")
 
 		config := LoadConfig()
-		assert.Equal(t, "myLevel", config.LogLevel)
+		assert.Equal(t, "debug", config.LogLevel)
 		assert.Equal(t, "127.0.0.1:4000", config.HTTPServerAddr)
+		assert.Equal(t, 100, config.BatchMaxSize)
+		assert.Equal(t, 5*time.Second, config.ShutdownTimeout)
+		assert.Equal(t, time.Second, config.ProduceTimeout)
+		assert.Equal(t, 3*time.Second, config.BatchProduceTimeout)
+		assert.Equal(t, 2*time.Second, config.HTTPServer.HandlerTimeout)
+		assert.Equal(t, env.Bytes(200<<10), config.HTTPServer.MaxBodyBytes)
+		assert.False(t, config.HTTPServer.HTTP2)
+		assert.True(t, config.HTTPServer.H2C)
+		assert.Equal(t, "/etc/receipt/tls.crt", config.HTTPServer.TLS.CertFile)
+		assert.Equal(t, "otlp", config.TraceExporter)
+		assert.Equal(t, 10*time.Second, config.LagMonitor.Interval)
+		assert.Equal(t, int64(50), config.LagMonitor.LagThreshold)
+		assert.Equal(t, time.Minute, config.LagMonitor.AgeThreshold)
+		assert.Equal(t, "admin-token", config.AdminToken)
 		assert.Equal(t, []string{"localhost:3001", "localhost:3002"}, config.BrokerConfig.SeedBrokers)
 		assert.Equal(t, "myTopic", config.BrokerConfig.Topic)
 		assert.Equal(t, 8, config.BrokerConfig.Partitions)
 		assert.Equal(t, 3, config.BrokerConfig.ReplicationFactor)
 		assert.Equal(t, "myGroup", config.BrokerConfig.ConsumerGroup)
+		assert.Equal(t, BalancerRange, config.BrokerConfig.Balancer)
+		assert.Equal(t, "receipt-1", config.BrokerConfig.InstanceID)
+		assert.True(t, config.BrokerConfig.AsyncProduce())
+		assert.Equal(t, 1000, config.BrokerConfig.MaxBufferedRecords)
+		assert.Equal(t, KeyStrategyINN, config.BrokerConfig.KeyStrategy)
+		assert.Equal(t, CodecProtobuf, config.BrokerConfig.Codec)
+		assert.Equal(t, "http://localhost:8081", config.BrokerConfig.SchemaRegistryURL.String())
+		assert.Equal(t, "/etc/receipt/keyring.json", config.BrokerConfig.KeyringFile)
+		assert.Equal(t, "myOutbox", config.BrokerConfig.OutboxTopic)
+		assert.Equal(t, kafkaclient.Security{
+			TLS: kafkaclient.TLS{Enabled: true},
+			SASL: kafkaclient.SASL{
+				Mechanism: kafkaclient.MechanismScramSHA256,
+				Username:  "receipt",
+				Password:  "secret",
+			},
+		}, config.BrokerConfig.Security)
+		assert.Equal(t, "myTxID", config.BrokerConfig.TransactionalID)
 	})
 
 	t.Run("should_panic", func(t *testing.T) {
+		t.Setenv("RECEIPT_LOG_LEVEL", "myLevel")
 		t.Setenv("RECEIPT_HTTP_ADDR", "notvalidaddr123456")
+		t.Setenv("RECEIPT_SHUTDOWN_TIMEOUT", "-1s")
+		t.Setenv("RECEIPT_TRACE_EXPORTER", "jaeger")
+		t.Setenv("RECEIPT_PRODUCE_TIMEOUT", "0s")
+		t.Setenv("RECEIPT_BATCH_PRODUCE_TIMEOUT", "0s")
+		t.Setenv("RECEIPT_HTTP_MAX_BODY_BYTES", "lots")
+		t.Setenv("RECEIPT_LAG_INTERVAL", "0s")
 		t.Setenv("RECEIPT_SEED_BROKERS", "notvalidbrokeraddr1,notvalidbrokeraddr2")
+		t.Setenv("RECEIPT_PRODUCE_MODE", "fire-and-forget")
+		t.Setenv("RECEIPT_KEY_STRATEGY", "random")
+		t.Setenv("RECEIPT_PARTITIONS", "0")
+		t.Setenv("RECEIPT_REPLICATION_FACTOR", "0")
+		t.Setenv("RECEIPT_MAX_BUFFERED_RECORDS", "many")
+		t.Setenv("RECEIPT_CODEC", "xml")
+		t.Setenv("RECEIPT_BALANCER", "eager")
+		t.Setenv("RECEIPT_SCHEMA_REGISTRY_URL", "ftp://registry")
 
 		require.Panics(t, func() {
 			LoadConfig()
 		})
 	})
+
+	t.Run("memory_schema_registry", func(t *testing.T) {
+		t.Setenv("RECEIPT_SCHEMA_REGISTRY_URL", "memory://local")
+
+		config := LoadConfig()
+		assert.Equal(t, "memory", config.BrokerConfig.SchemaRegistryURL.Scheme)
+	})
+
+	t.Run("should_panic_on_sasl_without_password", func(t *testing.T) {
+		t.Setenv("RECEIPT_KAFKA_SASL_MECHANISM", "PLAIN")
+		t.Setenv("RECEIPT_KAFKA_SASL_USERNAME", "receipt")
+
+		require.PanicsWithError(t,
+			"kafka SASL PLAIN: username and password are required",
+			func() { LoadConfig() })
+	})
 }
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"text/tabwriter"
+	"time"
+)
+
+const secretMask = "***"
+
+// Fprint writes the fields of the configuration struct. The embedded structs
+// are flattened, the nested ones are prefixed with the field name. The
+// fields tagged `secret:"true"` are masked. Only the password is masked in
+// the fields tagged `secret:"url"`.
+func Fprint(w io.Writer, cfg any) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fprintStruct(tw, "", reflect.ValueOf(cfg))
+	return tw.Flush()
+}
+
+func fprintStruct(w io.Writer, prefix string, v reflect.Value) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeFor[time.Time]() {
+			p := prefix
+			if !f.Anonymous {
+				p += f.Name + "."
+			}
+			fprintStruct(w, p, fv)
+			continue
+		}
+
+		value := formatValue(fv)
+		if secret := f.Tag.Get("secret"); secret != "" {
+			value = maskSecret(fv, secret == "url")
+		}
+		fmt.Fprintf(w, "%s%s:\t%s\n", prefix, f.Name, value)
+	}
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return `""`
+	}
+	switch x := v.Interface().(type) {
+	case time.Duration:
+		return x.String()
+	case fmt.Stringer:
+		return fmt.Sprintf("%q", x.String())
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice:
+		return fmt.Sprintf("%q", v.Interface())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func maskSecret(v reflect.Value, isURL bool) string {
+	if v.Kind() == reflect.String && v.String() == "" ||
+		v.Kind() == reflect.Pointer && v.IsNil() {
+		return formatValue(v)
+	}
+	if !isURL {
+		return secretMask
+	}
+	u, ok := v.Interface().(*url.URL)
+	if !ok && v.Kind() == reflect.String {
+		u, _ = url.Parse(v.String())
+	}
+	if u != nil && u.Scheme != "" && u.Host != "" {
+		return fmt.Sprintf("%q", u.Redacted())
+	}
+	return secretMask
+}
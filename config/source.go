@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/niksmo/receipt/pkg/env"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	flagConfig      = "config"
+	flagPrintConfig = "print-config"
+)
+
+// Options are the command line options common to the binaries.
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
+
+// Init sets up the configuration sources: the command line flags override
+// the env and the env overrides the config file. The settings are named
+// after the env variables without the prefix, e.g. RECEIPT_SEED_BROKERS is
+// set by the "--seed-brokers" flag and by the "seed_brokers" file key. The
+// config file is set by the "--config" flag or the <prefix>CONFIG_FILE env.
+func Init(prefix string, args []string) (Options, error) {
+	const op = "config.Init"
+
+	opts, flags, err := parseFlags(prefix, args)
+	if err != nil {
+		return Options{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if opts.ConfigFile == "" {
+		opts.ConfigFile = os.Getenv(prefix + "CONFIG_FILE")
+	}
+
+	layers := []env.Layer{{Name: "flags", Values: flags}, env.Process}
+	if opts.ConfigFile != "" {
+		values, err := readFile(prefix, opts.ConfigFile)
+		if err != nil {
+			return Options{}, fmt.Errorf("%s: %w", op, err)
+		}
+		layers = append(layers, env.Layer{Name: opts.ConfigFile, Values: values})
+	}
+	env.Use(layers...)
+
+	return opts, nil
+}
+
+// CheckUnknown reports the flags and the config file keys which are not
+// settings of the binary. It is called after the configuration is loaded.
+func CheckUnknown() error {
+	var errs []error
+	for source, names := range env.Unknown() {
+		errs = append(errs, fmt.Errorf(
+			"%s: unknown settings: %s", source, strings.Join(names, ", ")))
+	}
+	return errors.Join(errs...)
+}
+
+func parseFlags(
+	prefix string, args []string,
+) (Options, map[string]string, error) {
+	var opts Options
+	var errs []error
+	values := make(map[string]string)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			errs = append(errs, fmt.Errorf("unexpected argument %q", arg))
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == flagPrintConfig {
+			if !hasValue {
+				value = "true"
+			}
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("flag --%s: %w", name, err))
+			}
+			opts.PrintConfig = b
+			continue
+		}
+
+		if !hasValue {
+			if i+1 == len(args) {
+				errs = append(errs, fmt.Errorf("flag --%s: missing value", name))
+				continue
+			}
+			i++
+			value = args[i]
+		}
+
+		if name == flagConfig {
+			opts.ConfigFile = value
+			continue
+		}
+		values[envName(prefix, name)] = value
+	}
+	return opts, values, errors.Join(errs...)
+}
+
+// readFile reads the YAML or TOML config file. JSON is read as well, being
+// a subset of YAML. The nested keys are joined, so "lag: {interval: 10s}" is
+// the same as "lag_interval: 10s".
+func readFile(prefix string, path string) (map[string]string, error) {
+	var unmarshal func([]byte, any) error
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml", ".json":
+		unmarshal = yaml.Unmarshal
+	case ".toml":
+		unmarshal = toml.Unmarshal
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q", ext)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+	if err := unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten(values, prefix, doc)
+	return values, nil
+}
+
+func flatten(values map[string]string, prefix string, m map[string]any) {
+	for k, v := range m {
+		name := envName(prefix, k)
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(values, name+"_", v)
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, ",")
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+}
+
+// envName converts the flag or file key to the env variable name.
+func envName(prefix string, key string) string {
+	key = strings.Map(func(r rune) rune {
+		if slices.Contains([]rune{'-', '.'}, r) {
+			return '_'
+		}
+		return r
+	}, key)
+	return prefix + strings.ToUpper(key)
+}
@@ -0,0 +1,46 @@
+package adapter
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/port"
+	"github.com/niksmo/receipt/pkg/logger"
+)
+
+// PauseStatsProvider reports how long the consumption was paused because of
+// the notifier backpressure.
+type PauseStatsProvider interface {
+	PausedTime() time.Duration
+}
+
+type StatsHandler struct {
+	log     logger.Logger
+	service port.StatsProvider
+	pauses  PauseStatsProvider
+}
+
+func RegisterStatsHandler(
+	log logger.Logger,
+	mux *http.ServeMux,
+	service port.StatsProvider,
+	pauses PauseStatsProvider,
+) {
+	h := StatsHandler{log, service, pauses}
+	mux.HandleFunc("GET /v1/stats", h.GetStats)
+}
+
+func (h StatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	stats := h.service.Stats(r.Context())
+	res := Stats{
+		Sent:          stats.Sent,
+		Failed:        stats.Failed,
+		Retried:       stats.Retried,
+		Throttled:     stats.Throttled,
+		DeadLettered:  stats.DeadLettered,
+		PausedSeconds: h.pauses.PausedTime().Seconds(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,26 @@
+package adapter
+
+type Sender struct {
+	Email string `json:"email"`
+}
+
+type SendTo struct {
+	Email string `json:"email"`
+}
+
+type SendEmail struct {
+	Sender      Sender   `json:"sender"`
+	To          []SendTo `json:"to"`
+	Subject     string   `json:"subject"`
+	TextContent string   `json:"textContent"`
+	HTMLContent string   `json:"htmlContent,omitempty"`
+}
+
+type Stats struct {
+	Sent          int64   `json:"sent"`
+	Failed        int64   `json:"failed"`
+	Retried       int64   `json:"retried"`
+	Throttled     int64   `json:"throttled"`
+	DeadLettered  int64   `json:"deadLettered"`
+	PausedSeconds float64 `json:"pausedSeconds"`
+}
@@ -0,0 +1,415 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/port"
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/niksmo/receipt/pkg/outbox"
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/niksmo/receipt/pkg/tracing"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	fetchMaxWait      = 2 * time.Second
+	maxPollRecords    = 500
+	partitionQueueLen = 4
+	minPause          = 100 * time.Millisecond
+	deadLetterPause   = time.Second
+)
+
+type ConsumerConfig struct {
+	SeedBrokers []string
+	Topic       string
+	Group       string
+	// InstanceID enables the static group membership when set.
+	InstanceID string
+	Balancer   kgo.GroupBalancer
+	Security   kafkaclient.Security
+	// Keyring decrypts the mails encrypted by the receipt service, it is
+	// required if they are.
+	Keyring *fieldcrypt.Keyring
+}
+
+// KafkaConsumer dispatches the mails of the outbox topic. Each assigned
+// partition is handled by its own worker, which marks the partition offsets
+// after the batch is dispatched, so a mail is sent at least once. The marked
+// offsets are committed periodically and on revocation.
+type KafkaConsumer struct {
+	log     logger.Logger
+	kcl     *kgo.Client
+	topic   string
+	md      port.MailDispatcher
+	keyring *fieldcrypt.Keyring
+	workers *kafkaclient.Workers
+	// workCtx outlives the Run context, so the in-flight batches are
+	// finished on shutdown. It is canceled when the drain deadline is
+	// exceeded.
+	workCtx    context.Context
+	cancelWork context.CancelFunc
+	// failed is canceled with the cause when a record cannot be decrypted,
+	// Run returns then and no later offsets of the partition are marked.
+	failed context.Context
+	fail   context.CancelCauseFunc
+	done   chan struct{}
+}
+
+func NewKafkaConsumer(
+	log logger.Logger, cfg ConsumerConfig, md port.MailDispatcher,
+) *KafkaConsumer {
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	failed, fail := context.WithCancelCause(context.Background())
+	c := &KafkaConsumer{
+		log:        log,
+		topic:      cfg.Topic,
+		md:         md,
+		keyring:    cfg.Keyring,
+		workCtx:    workCtx,
+		cancelWork: cancelWork,
+		failed:     failed,
+		fail:       fail,
+		done:       make(chan struct{}),
+	}
+	c.workers = kafkaclient.NewWorkers(
+		workCtx, log, partitionQueueLen, c.handle)
+
+	opts, err := kafkaclient.Opts(cfg.SeedBrokers, cfg.Security)
+	if err != nil {
+		panic(err) // validated on config load
+	}
+
+	opts = append(opts,
+		kgo.ConsumeTopics(cfg.Topic),
+		kgo.ConsumerGroup(cfg.Group),
+		kgo.Balancers(cfg.Balancer),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.FetchMaxWait(fetchMaxWait),
+		kgo.AutoCommitMarks(),
+		kgo.BlockRebalanceOnPoll(),
+		kgo.OnPartitionsAssigned(c.workers.Assigned),
+		kgo.OnPartitionsRevoked(c.revoked),
+		// the lost partitions may be owned by another member already, so
+		// their in-flight batches are aborted and nothing is committed
+		kgo.OnPartitionsLost(c.workers.Lost),
+	)
+	if cfg.InstanceID != "" {
+		opts = append(opts, kgo.InstanceID(cfg.InstanceID))
+	}
+
+	kcl, err := kgo.NewClient(opts...)
+	if err != nil {
+		panic(err) // developer mistake
+	}
+	c.kcl = kcl
+	return c
+}
+
+// Run consumes the outbox topic until the context is done or a record cannot
+// be decrypted with the keyring.
+func (c *KafkaConsumer) Run(ctx context.Context) {
+	const op = "KafkaConsumer.Run"
+	log := c.log.WithOp(op)
+
+	log.Info().Msg("kafka consumer is running")
+	defer close(c.done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.failed, cancel)
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := context.Cause(c.failed); err != nil {
+				log.Error().Err(err).Msg("consumer is stopped")
+			}
+			return
+		default:
+			c.consume(ctx)
+		}
+	}
+}
+
+// PausedTime returns the total time the partitions were paused.
+func (c *KafkaConsumer) PausedTime() time.Duration {
+	return c.workers.PausedTime()
+}
+
+// Shutdown waits until Run returns and the workers finish their in-flight
+// batches, commits the marked offsets and leaves the group. The batches are
+// aborted if the context is done first.
+func (c *KafkaConsumer) Shutdown(ctx context.Context) {
+	const op = "KafkaConsumer.Shutdown"
+	log := c.log.WithOp(op)
+
+	log.Info().Msg("draining consumer")
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		c.workers.Stop()
+	}()
+	select {
+	case <-drained:
+		log.Info().Msg("consumer is drained")
+	case <-ctx.Done():
+		log.Warn().Msg("drain deadline exceeded, aborting in-flight batches")
+		c.cancelWork()
+		<-drained
+	}
+
+	if err := c.kcl.CommitMarkedOffsets(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to commit marked offsets")
+	}
+	c.Close()
+}
+
+// Close interrupts the in-flight batches, their offsets stay uncommitted.
+func (c *KafkaConsumer) Close() {
+	const op = "KafkaConsumer.Close"
+	log := c.log.WithOp(op)
+
+	log.Info().Msg("closing consumer")
+	c.cancelWork()
+	c.workers.Close()
+	c.kcl.Close()
+	log.Info().Msg("consumer is closed")
+}
+
+func (c *KafkaConsumer) CheckBroker(ctx context.Context) error {
+	const op = "KafkaConsumer.CheckBroker"
+
+	if err := kafkaclient.CheckBroker(ctx, c.kcl); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (c *KafkaConsumer) CheckTopic(ctx context.Context) error {
+	const op = "KafkaConsumer.CheckTopic"
+
+	if err := kafkaclient.CheckTopics(ctx, c.kcl, c.topic); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (c *KafkaConsumer) CheckGroup(context.Context) error {
+	const op = "KafkaConsumer.CheckGroup"
+
+	if err := kafkaclient.CheckGroup(c.kcl); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (c *KafkaConsumer) consume(ctx context.Context) {
+	const op = "KafkaConsumer.consume"
+	log := c.log.WithOp(op)
+
+	fetches, err := c.pollFetches(ctx)
+	defer c.kcl.AllowRebalance()
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Info().Msg("interrupted")
+			return
+		}
+		log.Error().Err(err).Msg("failed to poll fetches")
+		return
+	}
+
+	// A backlogged partition is paused by its worker, so the loop is never
+	// blocked by a slow partition.
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+		if !c.workers.Submit(p, nil) {
+			log.Warn().Str("topic", p.Topic).Int32(
+				"partition", p.Partition).Msg("partition is not assigned")
+		}
+	})
+}
+
+func (c *KafkaConsumer) pollFetches(ctx context.Context) (kgo.Fetches, error) {
+	const op = "KafkaConsumer.pollFetches"
+	log := c.log.WithOp(op)
+
+	fetches := c.kcl.PollRecords(ctx, maxPollRecords)
+	err := fetches.Err0()
+	if errors.Is(err, context.Canceled) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var errs []error
+	fetches.EachError(func(t string, p int32, err error) {
+		if err != nil {
+			fetchErr := fmt.Errorf("topic %q partition %d: %w", t, p, err)
+			errs = append(errs, fetchErr)
+		}
+	})
+
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("%s: %w", op, errors.Join(errs...))
+	}
+
+	metrics.ObserveBatchSize("consume", fetches.NumRecords())
+	kafkaclient.ObserveLag(c.kcl, fetches)
+	log.Debug().Int("nRecord", fetches.NumRecords()).Send()
+	return fetches, nil
+}
+
+// revoked lets the workers of the revoked partitions finish their in-flight
+// batches and commits the marked offsets synchronously, so the new owner does
+// not dispatch the batches again.
+func (c *KafkaConsumer) revoked(
+	ctx context.Context, kcl *kgo.Client, revoked map[string][]int32,
+) {
+	const op = "KafkaConsumer.revoked"
+	log := c.log.WithOp(op)
+
+	c.workers.Revoked(ctx, kcl, revoked)
+
+	if err := kcl.CommitMarkedOffsets(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to commit marked offsets")
+	}
+}
+
+// handle dispatches the batch of a single partition and marks its offsets.
+// Once the notifier throttles, the partition is paused for the wait it asked
+// for and the pending mails are dispatched again on resume.
+func (c *KafkaConsumer) handle(
+	ctx context.Context, w *kafkaclient.PartitionWorker, recs []*kgo.Record,
+) error {
+	const op = "KafkaConsumer.handle"
+	log := c.log.WithOp(op).With().Str("topic", w.Topic()).Int32(
+		"partition", w.Partition()).Logger()
+
+	// The batch span is linked to the trace of every record, so the mails
+	// dispatched within it can be found from the receipt trace.
+	ctx, span := tracing.Start(ctx, "process "+w.Topic(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(recordLinks(recs)...),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", w.Topic()),
+			attribute.Int("messaging.batch.message_count", len(recs)),
+		),
+	)
+	defer span.End()
+
+	if c.failed.Err() != nil {
+		return fmt.Errorf("%s: %w", op, context.Cause(c.failed))
+	}
+	mails, err := c.retrieveMails(recs)
+	if err != nil {
+		// skipping the records would lose them, the consumer stops
+		c.fail(err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+dispatch:
+	for len(mails) != 0 {
+		err := c.md.DispatchMails(ctx, mails)
+		if ctx.Err() != nil {
+			// the batch may be dispatched partially, leave it to the next run
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		}
+
+		var (
+			throttledErr  *domain.ThrottledError
+			deadLetterErr *domain.DeadLetterError
+			pause         time.Duration
+		)
+		switch {
+		case errors.As(err, &throttledErr):
+			// the records do not pile up while the notifier is saturated
+			pause = max(throttledErr.RetryAfter, minPause)
+			mails = throttledErr.Pending
+		case errors.As(err, &deadLetterErr):
+			// marking the records would lose the mails
+			log.Error().Err(err).Int("nPending", len(deadLetterErr.Pending)).Msg(
+				"failed mails are not dead-lettered, retrying")
+			pause = deadLetterPause
+			mails = deadLetterErr.Pending
+		default:
+			break dispatch
+		}
+		if !w.Pause(pause) {
+			// the partition is revoked, the batch is left to the next owner
+			return fmt.Errorf("%s: %w", op, kafkaclient.ErrWorkerStopped)
+		}
+	}
+
+	c.kcl.MarkCommitRecords(recs...)
+	log.Debug().Int64("offset", recs[len(recs)-1].Offset).Msg("offsets marked")
+	return nil
+}
+
+// retrieveMails skips the records failed to decode. It returns an error if a
+// record cannot be decrypted with the keyring.
+func (c *KafkaConsumer) retrieveMails(
+	recs []*kgo.Record,
+) ([]domain.Mail, error) {
+	const op = "KafkaConsumer.retrieveMails"
+	log := c.log.WithOp(op)
+
+	mails := make([]domain.Mail, 0, len(recs))
+	for _, rec := range recs {
+		var evt outbox.MailV1
+		if err := json.Unmarshal(rec.Value, &evt); err != nil {
+			log.Error().Err(err).Str("key", string(rec.Key)).Msg(
+				"failed to unmarshal record value")
+			continue
+		}
+		err := evt.Decrypt(c.keyring, rec)
+		if fieldcrypt.IsMissingKey(err) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err != nil {
+			log.Error().Err(err).Str("key", string(rec.Key)).Msg(
+				"failed to decrypt record value")
+			continue
+		}
+		mail := MailFromOutboxV1(evt)
+		mail.RequestID = recordHeader(rec, requestid.RecordHeader)
+		mails = append(mails, mail)
+	}
+	return mails, nil
+}
+
+func recordLinks(recs []*kgo.Record) []trace.Link {
+	links := make([]trace.Link, 0, len(recs))
+	for _, rec := range recs {
+		ctx := tracing.Extract(
+			context.Background(), tracing.RecordCarrier{Record: rec})
+		if link := trace.LinkFromContext(ctx); link.SpanContext.IsValid() {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+func recordHeader(rec *kgo.Record, key string) string {
+	for _, h := range rec.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
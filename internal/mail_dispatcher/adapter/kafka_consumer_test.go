@@ -0,0 +1,462 @@
+//go:build !integration
+
+package adapter_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/config"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/adapter"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/outbox"
+	"github.com/niksmo/receipt/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	testTopic = "mail-outbox"
+	testGroup = "mail-dispatcher-group"
+)
+
+// dispatched counts the dispatches of each mail.
+type dispatched struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (d *dispatched) add(mails []domain.Mail) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, m := range mails {
+		d.counts[m.ReceiptUUID]++
+	}
+}
+
+func (d *dispatched) snapshot() map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	counts := make(map[string]int, len(d.counts))
+	for k, v := range d.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// dispatcherFunc adapts a function to port.MailDispatcher.
+type dispatcherFunc func(ctx context.Context, mails []domain.Mail) error
+
+func (f dispatcherFunc) DispatchMails(
+	ctx context.Context, mails []domain.Mail,
+) error {
+	return f(ctx, mails)
+}
+
+func newTestConsumer(
+	t *testing.T, seedBrokers []string, md dispatcherFunc,
+) *adapter.KafkaConsumer {
+	t.Helper()
+	return runTestConsumer(t, testConsumerConfig(seedBrokers), md)
+}
+
+func testConsumerConfig(seedBrokers []string) adapter.ConsumerConfig {
+	return adapter.ConsumerConfig{
+		SeedBrokers: seedBrokers,
+		Topic:       testTopic,
+		Group:       testGroup,
+		Balancer:    config.BalancerCooperativeSticky.GroupBalancer(),
+	}
+}
+
+func runTestConsumer(
+	t *testing.T, cfg adapter.ConsumerConfig, md dispatcherFunc,
+) *adapter.KafkaConsumer {
+	t.Helper()
+	c := adapter.NewKafkaConsumer(logger.New("disabled"), cfg, md)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		c.Close()
+		<-done
+	})
+	return c
+}
+
+func produceMails(
+	t *testing.T, seedBrokers []string, partitions int32, from, to int,
+) []string {
+	t.Helper()
+	kcl, err := kgo.NewClient(
+		kgo.SeedBrokers(seedBrokers...),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()),
+	)
+	require.NoError(t, err)
+	defer kcl.Close()
+
+	var uuids []string
+	var recs []*kgo.Record
+	for p := range partitions {
+		for i := from; i < to; i++ {
+			uuid := fmt.Sprintf("%d-%d", p, i)
+			value, err := json.Marshal(outbox.MailV1{ReceiptUUID: uuid})
+			require.NoError(t, err)
+			recs = append(recs, &kgo.Record{
+				Topic: testTopic, Partition: p, Value: value,
+			})
+			uuids = append(uuids, uuid)
+		}
+	}
+	require.NoError(t, kcl.ProduceSync(context.Background(), recs...).FirstErr())
+	return uuids
+}
+
+func TestKafkaConsumerRevoke(t *testing.T) {
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(2, testTopic))
+	require.NoError(t, err)
+	defer c.Close()
+
+	// The second round of SyncGroup requests assigns a partition of the
+	// first member to the second one, the revoke follows.
+	var nSync atomic.Int32
+	rebalanced := make(chan struct{})
+	c.ControlKey(kmsg.SyncGroup.Int16(), func(kmsg.Request) (kmsg.Response, error, bool) {
+		c.KeepControl()
+		if nSync.Add(1) == 3 {
+			close(rebalanced)
+		}
+		return nil, nil, false
+	})
+
+	uuids := produceMails(t, c.ListenAddrs(), 2, 0, 10)
+
+	var d dispatched
+	d.counts = make(map[string]int)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	newTestConsumer(t, c.ListenAddrs(), func(
+		ctx context.Context, mails []domain.Mail,
+	) error {
+		// The batches of the first member are in-flight on the rebalance.
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		d.add(mails)
+		return nil
+	})
+	<-started
+
+	newTestConsumer(t, c.ListenAddrs(), func(
+		_ context.Context, mails []domain.Mail,
+	) error {
+		d.add(mails)
+		return nil
+	})
+
+	select {
+	case <-rebalanced:
+	case <-time.After(15 * time.Second):
+		t.Fatal("second member did not join the group")
+	}
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+
+	// The new owner dispatches the revoked partition from its committed
+	// offset, so the records dispatched again would precede the new ones.
+	uuids = append(uuids, produceMails(t, c.ListenAddrs(), 2, 10, 20)...)
+	require.Eventually(t, func() bool {
+		return len(d.snapshot()) == len(uuids)
+	}, 15*time.Second, 10*time.Millisecond)
+
+	counts := d.snapshot()
+	for _, uuid := range uuids {
+		assert.Equal(t, 1, counts[uuid], "mail %s", uuid)
+	}
+}
+
+func TestKafkaConsumerThrottled(t *testing.T) {
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic))
+	require.NoError(t, err)
+	defer c.Close()
+
+	uuids := produceMails(t, c.ListenAddrs(), 1, 0, 3)
+
+	const retryAfter = 300 * time.Millisecond
+	type call struct {
+		at    time.Time
+		uuids []string
+	}
+	calls := make(chan call, 8)
+	var nCall atomic.Int32
+	consumer := newTestConsumer(t, c.ListenAddrs(), func(
+		_ context.Context, mails []domain.Mail,
+	) error {
+		cl := call{at: time.Now()}
+		for _, m := range mails {
+			cl.uuids = append(cl.uuids, m.ReceiptUUID)
+		}
+		calls <- cl
+		if nCall.Add(1) == 1 {
+			// the first mail is sent, the others are pending
+			return &domain.ThrottledError{
+				RetryAfter: retryAfter, Pending: mails[1:],
+			}
+		}
+		return nil
+	})
+
+	first := <-calls
+	assert.Equal(t, uuids, first.uuids)
+
+	// The pending mails are dispatched again once the partition is resumed,
+	// the records produced meanwhile wait for them.
+	uuids = append(uuids, produceMails(t, c.ListenAddrs(), 1, 3, 4)...)
+	second := <-calls
+	assert.Equal(t, uuids[1:3], second.uuids)
+	assert.GreaterOrEqual(t, second.at.Sub(first.at), retryAfter)
+
+	third := <-calls
+	assert.Equal(t, uuids[3:], third.uuids)
+	assert.GreaterOrEqual(t, consumer.PausedTime(), retryAfter)
+}
+
+func TestKafkaConsumerDeadLetterFailed(t *testing.T) {
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic))
+	require.NoError(t, err)
+	defer c.Close()
+
+	uuids := produceMails(t, c.ListenAddrs(), 1, 0, 2)
+
+	calls := make(chan []string, 8)
+	var nCall atomic.Int32
+	newTestConsumer(t, c.ListenAddrs(), func(
+		_ context.Context, mails []domain.Mail,
+	) error {
+		var got []string
+		for _, m := range mails {
+			got = append(got, m.ReceiptUUID)
+		}
+		calls <- got
+		if nCall.Add(1) == 1 {
+			// the last mail is neither sent nor dead-lettered
+			return &domain.DeadLetterError{
+				Err: errors.New("broker is down"), Pending: mails[1:],
+			}
+		}
+		return nil
+	})
+
+	assert.Equal(t, uuids, <-calls)
+	assert.Equal(t, uuids[1:], <-calls)
+}
+
+func TestKafkaConsumerShutdown(t *testing.T) {
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic))
+	require.NoError(t, err)
+	defer c.Close()
+
+	uuids := produceMails(t, c.ListenAddrs(), 1, 0, 3)
+
+	var d dispatched
+	d.counts = make(map[string]int)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	consumer := adapter.NewKafkaConsumer(logger.New("disabled"), adapter.ConsumerConfig{
+		SeedBrokers: c.ListenAddrs(),
+		Topic:       testTopic,
+		Group:       testGroup,
+		Balancer:    config.BalancerCooperativeSticky.GroupBalancer(),
+	}, dispatcherFunc(func(ctx context.Context, mails []domain.Mail) error {
+		close(started)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		d.add(mails)
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go consumer.Run(ctx)
+	<-started
+	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(
+		context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		consumer.Shutdown(shutdownCtx)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("shutdown returned before the in-flight batch is finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	<-stopped
+	assert.Len(t, d.snapshot(), len(uuids))
+
+	// The drained batch is committed, the next member starts after it.
+	uuids = append(uuids, produceMails(t, c.ListenAddrs(), 1, 3, 4)...)
+	newTestConsumer(t, c.ListenAddrs(), func(
+		_ context.Context, mails []domain.Mail,
+	) error {
+		d.add(mails)
+		return nil
+	})
+	require.Eventually(t, func() bool {
+		return len(d.snapshot()) == len(uuids)
+	}, 15*time.Second, 10*time.Millisecond)
+
+	counts := d.snapshot()
+	for _, uuid := range uuids {
+		assert.Equal(t, 1, counts[uuid], "mail %s", uuid)
+	}
+}
+
+func TestKafkaConsumerTraceLinks(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tracing.Install("test", sdktrace.WithSyncer(exp))
+
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic))
+	require.NoError(t, err)
+	defer c.Close()
+
+	kcl, err := kgo.NewClient(kgo.SeedBrokers(c.ListenAddrs()...))
+	require.NoError(t, err)
+	defer kcl.Close()
+
+	ctx, span := tracing.Start(context.Background(), "publish")
+	value, err := json.Marshal(outbox.MailV1{ReceiptUUID: "a"})
+	require.NoError(t, err)
+	rec := &kgo.Record{Topic: testTopic, Value: value}
+	tracing.Inject(ctx, tracing.RecordCarrier{Record: rec})
+	span.End()
+	require.NoError(t, kcl.ProduceSync(ctx, rec).FirstErr())
+
+	dispatched := make(chan string, 1)
+	newTestConsumer(t, c.ListenAddrs(), func(
+		ctx context.Context, mails []domain.Mail,
+	) error {
+		dispatched <- tracing.TraceID(ctx)
+		return nil
+	})
+	batchTraceID := <-dispatched
+
+	require.Eventually(t, func() bool {
+		for _, s := range exp.GetSpans() {
+			if s.Name == "process "+testTopic {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, s := range exp.GetSpans() {
+		if s.Name != "process "+testTopic {
+			continue
+		}
+		assert.Equal(t, batchTraceID, s.SpanContext.TraceID().String())
+		require.Len(t, s.Links, 1)
+		assert.Equal(t, tracing.TraceID(ctx),
+			s.Links[0].SpanContext.TraceID().String())
+	}
+}
+
+func TestKafkaConsumerDecrypt(t *testing.T) {
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic))
+	require.NoError(t, err)
+	defer c.Close()
+
+	keyring, err := fieldcrypt.NewKeyring("k1", map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+	}, bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+
+	kcl, err := kgo.NewClient(kgo.SeedBrokers(c.ListenAddrs()...))
+	require.NoError(t, err)
+	defer kcl.Close()
+
+	const email = "john.doe@example.com"
+	evt := outbox.MailV1{ReceiptUUID: "a", To: email, Text: "Dear " + email}
+	headers, err := evt.Encrypt(keyring)
+	require.NoError(t, err)
+	value, err := json.Marshal(evt)
+	require.NoError(t, err)
+	require.NoError(t, kcl.ProduceSync(context.Background(), &kgo.Record{
+		Topic: testTopic, Value: value, Headers: headers,
+	}).FirstErr())
+
+	dispatched := make(chan domain.Mail, 1)
+	md := dispatcherFunc(func(_ context.Context, mails []domain.Mail) error {
+		for _, m := range mails {
+			dispatched <- m
+		}
+		return nil
+	})
+
+	// The consumer without the keyring stops instead of skipping the record.
+	consumer := adapter.NewKafkaConsumer(
+		logger.New("disabled"), testConsumerConfig(c.ListenAddrs()), md)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		consumer.Run(context.Background())
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(15 * time.Second):
+		t.Fatal("consumer without the keyring did not stop")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	consumer.Shutdown(ctx)
+	assert.Empty(t, dispatched)
+
+	cfg := testConsumerConfig(c.ListenAddrs())
+	cfg.Keyring = keyring
+	runTestConsumer(t, cfg, md)
+	select {
+	case m := <-dispatched:
+		assert.Equal(t, email, m.To)
+		assert.Equal(t, "Dear "+email, m.Text)
+	case <-time.After(15 * time.Second):
+		t.Fatal("record is not dispatched")
+	}
+}
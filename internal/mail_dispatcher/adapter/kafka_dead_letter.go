@@ -0,0 +1,163 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/port"
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/niksmo/receipt/pkg/outbox"
+	"github.com/niksmo/receipt/pkg/redact"
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var _ port.DeadLetterProducer = (*KafkaDeadLetterProducer)(nil)
+
+const (
+	produceRetries = 3
+	dlqFieldReason = "reason"
+)
+
+type KafkaDeadLetterProducer struct {
+	log     logger.Logger
+	kcl     *kgo.Client
+	topic   string
+	redact  bool
+	keyring *fieldcrypt.Keyring
+}
+
+// NewKafkaDeadLetterProducer creates the producer. If redact is set, the
+// recipient and the contacts in the mail body and the reason are masked, so
+// the dead letters cannot be replayed. The keyring is optional, they are
+// encrypted when it is set.
+func NewKafkaDeadLetterProducer(
+	log logger.Logger,
+	seedBrokers []string,
+	security kafkaclient.Security,
+	topic string,
+	redact bool,
+	keyring *fieldcrypt.Keyring,
+) *KafkaDeadLetterProducer {
+	opts, err := kafkaclient.Opts(seedBrokers, security)
+	if err != nil {
+		panic(err) // validated on config load
+	}
+
+	kcl, err := kgo.NewClient(append(opts,
+		kgo.DefaultProduceTopic(topic),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.RecordRetries(produceRetries),
+	)...)
+	if err != nil {
+		panic(err) // developer mistake
+	}
+	return &KafkaDeadLetterProducer{
+		log: log, kcl: kcl, topic: topic, redact: redact, keyring: keyring,
+	}
+}
+
+func (p *KafkaDeadLetterProducer) ProduceDeadLetter(
+	ctx context.Context, dl domain.DeadLetter,
+) error {
+	const op = "KafkaDeadLetterProducer.ProduceDeadLetter"
+
+	if p.redact {
+		dl = redactDeadLetter(dl)
+	}
+
+	evt := NewDeadLetterV1(dl)
+	var headers []kgo.RecordHeader
+	if p.keyring != nil {
+		env, err := p.keyring.Encrypt(
+			evt.ReceiptUUID, &evt.To, &evt.Text, &evt.HTML, &evt.Reason)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		headers = fieldcrypt.RecordHeaders(env, outbox.FieldTo,
+			outbox.FieldText, outbox.FieldHTML, dlqFieldReason)
+	}
+
+	v, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	kr := &kgo.Record{
+		Topic:   p.topic,
+		Key:     []byte(dl.Mail.ReceiptUUID),
+		Value:   v,
+		Headers: headers,
+	}
+	if dl.Mail.RequestID != "" {
+		kr.Headers = append(kr.Headers, kgo.RecordHeader{
+			Key: requestid.RecordHeader, Value: []byte(dl.Mail.RequestID),
+		})
+	}
+	start := time.Now()
+	err = p.kcl.ProduceSync(ctx, kr).FirstErr()
+	metrics.ObserveProduce(p.topic, start, err)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	metrics.IncDeadLetter(p.topic)
+	return nil
+}
+
+func (p *KafkaDeadLetterProducer) InitTopic(
+	ctx context.Context, partitions int, repFactor int, onFall func(err error),
+) {
+	const op = "KafkaDeadLetterProducer.InitTopic"
+	log := p.log.WithOp(op)
+
+	err := kafkaclient.CreateTopic(ctx, log, p.kcl, p.topic, partitions, repFactor)
+	if err != nil {
+		onFall(fmt.Errorf("%s: %w", op, err))
+	}
+}
+
+func (p *KafkaDeadLetterProducer) CheckTopic(ctx context.Context) error {
+	const op = "KafkaDeadLetterProducer.CheckTopic"
+
+	if err := kafkaclient.CheckTopics(ctx, p.kcl, p.topic); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Shutdown waits until the buffered dead letters are delivered or the
+// context is done, then closes the producer.
+func (p *KafkaDeadLetterProducer) Shutdown(ctx context.Context) {
+	const op = "KafkaDeadLetterProducer.Shutdown"
+	log := p.log.WithOp(op)
+
+	log.Info().Int64(
+		"nBuffered", p.kcl.BufferedProduceRecords()).Msg("flushing producer")
+	if err := p.kcl.Flush(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to flush producer")
+	}
+	p.Close()
+}
+
+func (p *KafkaDeadLetterProducer) Close() {
+	const op = "KafkaDeadLetterProducer.Close"
+	log := p.log.WithOp(op)
+
+	log.Info().Msg("closing producer")
+	p.kcl.Close()
+	log.Info().Msg("producer is closed")
+}
+
+func redactDeadLetter(dl domain.DeadLetter) domain.DeadLetter {
+	dl.Mail.To = redact.Email(dl.Mail.To)
+	dl.Mail.Text = redact.Text(dl.Mail.Text)
+	dl.Mail.HTML = redact.Text(dl.Mail.HTML)
+	dl.Reason = redact.Text(dl.Reason)
+	return dl
+}
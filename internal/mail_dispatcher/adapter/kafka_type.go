@@ -0,0 +1,41 @@
+package adapter
+
+import (
+	"time"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+	"github.com/niksmo/receipt/pkg/outbox"
+)
+
+func MailFromOutboxV1(e outbox.MailV1) domain.Mail {
+	return domain.Mail{
+		ReceiptUUID: e.ReceiptUUID,
+		To:          e.To,
+		Subject:     e.Subject,
+		Text:        e.Text,
+		HTML:        e.HTML,
+	}
+}
+
+// DeadLetterV1 is the wire contract of the mail dead letter topic.
+type DeadLetterV1 struct {
+	outbox.MailV1
+	Reason   string    `json:"reason"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+func NewDeadLetterV1(dl domain.DeadLetter) DeadLetterV1 {
+	return DeadLetterV1{
+		MailV1: outbox.MailV1{
+			ReceiptUUID: dl.Mail.ReceiptUUID,
+			To:          dl.Mail.To,
+			Subject:     dl.Mail.Subject,
+			Text:        dl.Mail.Text,
+			HTML:        dl.Mail.HTML,
+		},
+		Reason:   dl.Reason,
+		Attempts: dl.Attempts,
+		FailedAt: dl.FailedAt,
+	}
+}
@@ -0,0 +1,15 @@
+package adapter
+
+import (
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/port"
+	"github.com/niksmo/receipt/pkg/metrics"
+)
+
+var _ port.Metrics = PromMetrics{}
+
+// PromMetrics records the service metrics to the Prometheus registry.
+type PromMetrics struct{}
+
+func (PromMetrics) IncDelivery(outcome string) {
+	metrics.IncDelivery(outcome)
+}
@@ -0,0 +1,219 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/port"
+	"github.com/niksmo/receipt/pkg/breaker"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/niksmo/receipt/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+var _ port.MailSender = (*NotifierClient)(nil)
+
+const (
+	defaultRetryAfter = 1 * time.Second
+	maxErrorBodySize  = 1024
+	healthPath        = "/healthz"
+)
+
+type NotifierConfig struct {
+	URL         string
+	SenderEmail string
+	// RateLimit is the token bucket refill rate per second, non-positive
+	// value disables the limiter.
+	RateLimit int
+	RateBurst int
+	// Timeout bounds every single attempt.
+	Timeout time.Duration
+	// BreakerThreshold is the number of consecutive failures opening the
+	// circuit breaker, it must be positive.
+	BreakerThreshold   int
+	BreakerOpenTimeout time.Duration
+}
+
+// NotifierClient sends the mails to the notifier. It returns the error
+// wrapping domain.ErrRejected for 4xx responses, which must not be retried,
+// and *domain.ThrottledError for 429 responses or the open circuit breaker.
+// The 429 responses are left to the caller backoff, they do not count as
+// the breaker failures.
+type NotifierClient struct {
+	log         logger.Logger
+	client      *http.Client
+	baseURL     string
+	url         string
+	senderEmail string
+	timeout     time.Duration
+	limiter     *rate.Limiter
+	breaker     *breaker.Breaker
+}
+
+func NewNotifierClient(log logger.Logger, cfg NotifierConfig) *NotifierClient {
+	return &NotifierClient{
+		log:         log,
+		client:      &http.Client{},
+		baseURL:     strings.TrimSuffix(cfg.URL, "/"),
+		url:         strings.TrimSuffix(cfg.URL, "/") + "/v1/email",
+		senderEmail: cfg.SenderEmail,
+		timeout:     cfg.Timeout,
+		limiter:     createLimiter(cfg.RateLimit, cfg.RateBurst),
+		breaker:     breaker.New(cfg.BreakerThreshold, cfg.BreakerOpenTimeout),
+	}
+}
+
+func (c *NotifierClient) SendMail(ctx context.Context, mail domain.Mail) error {
+	const op = "NotifierClient.SendMail"
+	log := c.log.WithOp(op)
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	call, retryAfter, ok := c.breaker.Allow()
+	if !ok {
+		return fmt.Errorf(
+			"%s: circuit breaker is open: %w",
+			op, &domain.ThrottledError{RetryAfter: retryAfter},
+		)
+	}
+
+	ctx, span := tracing.Start(ctx, "POST /v1/email",
+		trace.WithSpanKind(trace.SpanKindClient))
+	err := c.send(ctx, mail)
+	tracing.End(span, err)
+
+	switch {
+	case ctx.Err() != nil, errors.Is(err, domain.ErrThrottled):
+		call.Cancel()
+	default:
+		// the rejected mail proves the notifier is healthy
+		call.Done(err == nil || errors.Is(err, domain.ErrRejected))
+		if c.breaker.State() == breaker.StateOpen {
+			log.Warn().Msg("circuit breaker is open")
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// CheckReachable probes the notifier health route, the notifier is ready if
+// it answers 2xx. The circuit breaker is not involved.
+func (c *NotifierClient) CheckReachable(ctx context.Context) error {
+	const op = "NotifierClient.CheckReachable"
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, c.baseURL+healthPath, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %d", op, res.StatusCode)
+	}
+	return nil
+}
+
+func (c *NotifierClient) send(ctx context.Context, mail domain.Mail) error {
+	const op = "NotifierClient.send"
+
+	body, err := json.Marshal(c.toSendEmail(mail))
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, domain.ErrRejected, err)
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.HeaderName, id)
+	}
+	tracing.InjectHTTP(req)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer res.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("http.response.status_code", res.StatusCode))
+	resBody, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+
+	switch code := res.StatusCode; {
+	case code == http.StatusCreated:
+		return nil
+	case code == http.StatusTooManyRequests:
+		retryAfter := parseRetryAfter(res.Header.Get("Retry-After"))
+		return fmt.Errorf(
+			"%s: %w", op, &domain.ThrottledError{RetryAfter: retryAfter})
+	case code == http.StatusRequestTimeout:
+		return fmt.Errorf("%s: unexpected status %d", op, code)
+	case code >= 400 && code < 500:
+		return fmt.Errorf(
+			"%s: %w: status %d: %s",
+			op, domain.ErrRejected, code, strings.TrimSpace(string(resBody)),
+		)
+	default:
+		return fmt.Errorf("%s: unexpected status %d", op, code)
+	}
+}
+
+func (c *NotifierClient) toSendEmail(mail domain.Mail) SendEmail {
+	return SendEmail{
+		Sender:      Sender{Email: c.senderEmail},
+		To:          []SendTo{{Email: mail.To}},
+		Subject:     mail.Subject,
+		TextContent: mail.Text,
+		HTMLContent: mail.HTML,
+	}
+}
+
+// parseRetryAfter supports both the delay seconds and the HTTP date forms.
+func parseRetryAfter(v string) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if date, err := http.ParseTime(v); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return defaultRetryAfter
+}
+
+func createLimiter(limit int, burst int) *rate.Limiter {
+	if limit <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(limit), max(burst, 1))
+}
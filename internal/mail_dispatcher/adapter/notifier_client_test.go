@@ -0,0 +1,99 @@
+//go:build !integration
+
+package adapter_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/adapter"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNotifier(
+	t *testing.T, status int,
+) (*adapter.NotifierClient, *atomic.Int32) {
+	t.Helper()
+	var nReq atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			nReq.Add(1)
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+		}))
+	t.Cleanup(srv.Close)
+
+	c := adapter.NewNotifierClient(logger.New("disabled"), adapter.NotifierConfig{
+		URL:                srv.URL,
+		Timeout:            time.Second,
+		BreakerThreshold:   2,
+		BreakerOpenTimeout: time.Minute,
+	})
+	return c, &nReq
+}
+
+func TestNotifierClientBreaker(t *testing.T) {
+	ctx := context.Background()
+	mail := domain.Mail{ReceiptUUID: "a", To: "customer@example.com"}
+
+	t.Run("too_many_requests_keeps_closed", func(t *testing.T) {
+		c, nReq := newTestNotifier(t, http.StatusTooManyRequests)
+		for range 5 {
+			var throttledErr *domain.ThrottledError
+			require.ErrorAs(t, c.SendMail(ctx, mail), &throttledErr)
+		}
+		assert.Equal(t, int32(5), nReq.Load())
+	})
+
+	t.Run("server_error_opens", func(t *testing.T) {
+		c, nReq := newTestNotifier(t, http.StatusBadGateway)
+		for range 5 {
+			require.Error(t, c.SendMail(ctx, mail))
+		}
+		assert.Equal(t, int32(2), nReq.Load())
+
+		var throttledErr *domain.ThrottledError
+		require.ErrorAs(t, c.SendMail(ctx, mail), &throttledErr)
+		assert.Positive(t, throttledErr.RetryAfter)
+	})
+}
+
+func TestNotifierClientCheckReachable(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"ok", http.StatusOK, false},
+		{"not_found", http.StatusNotFound, true},
+		{"unavailable", http.StatusServiceUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					path = r.URL.Path
+					w.WriteHeader(tt.status)
+				}))
+			defer srv.Close()
+
+			c := adapter.NewNotifierClient(logger.New("disabled"),
+				adapter.NotifierConfig{URL: srv.URL, BreakerThreshold: 1})
+			err := c.CheckReachable(context.Background())
+			assert.Equal(t, "/healthz", path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Mail struct {
+	ReceiptUUID string
+	To          string
+	Subject     string
+	Text        string
+	HTML        string
+	// RequestID is the ID of the client request the receipt was sent by.
+	RequestID string
+}
+
+// DeadLetter is the mail the notifier rejected or failed to send after all
+// retries.
+type DeadLetter struct {
+	Mail     Mail
+	Reason   string
+	Attempts int
+	FailedAt time.Time
+}
+
+type Stats struct {
+	Sent         int64
+	Failed       int64
+	Retried      int64
+	Throttled    int64
+	DeadLettered int64
+}
+
+// ErrRejected reports the notifier rejected the mail, so retrying it is
+// pointless.
+var ErrRejected = errors.New("mail is rejected")
+
+// ErrThrottled reports the notifier is saturated, the mails should be sent
+// later.
+var ErrThrottled = errors.New("notifier is throttled")
+
+// ThrottledError reports how long the notifier asks to wait. The dispatcher
+// sets Pending to the mails it left unsent, they should be dispatched again
+// after the wait.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Pending    []Mail
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrThrottled, e.RetryAfter)
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return ErrThrottled
+}
+
+// ErrDeadLetter reports the mails failed to send are not dead-lettered
+// either.
+var ErrDeadLetter = errors.New("dead letter is not produced")
+
+// DeadLetterError reports the mails neither sent nor dead-lettered. They
+// should be dispatched again, their records must not be committed meanwhile.
+type DeadLetterError struct {
+	Err     error
+	Pending []Mail
+}
+
+func (e *DeadLetterError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrDeadLetter, e.Err)
+}
+
+func (e *DeadLetterError) Unwrap() []error {
+	return []error{ErrDeadLetter, e.Err}
+}
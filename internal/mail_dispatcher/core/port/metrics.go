@@ -0,0 +1,6 @@
+package port
+
+// Metrics records the service metrics.
+type Metrics interface {
+	IncDelivery(outcome string)
+}
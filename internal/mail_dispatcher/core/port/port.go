@@ -0,0 +1,26 @@
+package port
+
+import (
+	"context"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+)
+
+type MailSender interface {
+	SendMail(ctx context.Context, mail domain.Mail) error
+}
+
+type DeadLetterProducer interface {
+	ProduceDeadLetter(ctx context.Context, dl domain.DeadLetter) error
+}
+
+type MailDispatcher interface {
+	// DispatchMails stops on the first mail the notifier throttled and
+	// returns *domain.ThrottledError with the unsent mails, the caller should
+	// wait and dispatch them again.
+	DispatchMails(ctx context.Context, mails []domain.Mail) error
+}
+
+type StatsProvider interface {
+	Stats(ctx context.Context) domain.Stats
+}
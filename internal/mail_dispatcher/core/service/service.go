@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/port"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/niksmo/receipt/pkg/tracing"
+)
+
+const (
+	outcomeSent         = "sent"
+	outcomeFailed       = "failed"
+	outcomeRetried      = "retried"
+	outcomeThrottled    = "throttled"
+	outcomeDeadLettered = "dead_lettered"
+)
+
+const (
+	retryBaseDelay   = 100 * time.Millisecond
+	retryMaxDelay    = 5 * time.Second
+	retryMaxBackoffN = 16
+)
+
+var _ port.MailDispatcher = (*Service)(nil)
+var _ port.StatsProvider = (*Service)(nil)
+
+type Service struct {
+	log         logger.Logger
+	sender      port.MailSender
+	dlq         port.DeadLetterProducer
+	metrics     port.Metrics
+	concurrency int
+	maxRetries  int
+	nSent       atomic.Int64
+	nFailed     atomic.Int64
+	nRetried    atomic.Int64
+	nThrottled  atomic.Int64
+	nDeadLetter atomic.Int64
+}
+
+func NewService(
+	log logger.Logger,
+	sender port.MailSender,
+	dlq port.DeadLetterProducer,
+	metrics port.Metrics,
+	concurrency int,
+	maxRetries int,
+) *Service {
+	return &Service{
+		log:         log,
+		sender:      sender,
+		dlq:         dlq,
+		metrics:     metrics,
+		concurrency: max(concurrency, 1),
+		maxRetries:  max(maxRetries, 0),
+	}
+}
+
+// DispatchMails sends the mails concurrently and returns when every mail is
+// either sent or dead-lettered after all retries. The first throttled mail
+// stops the batch: no more mails are started, the in-flight ones are not
+// retried and the unsent mails are returned by *domain.ThrottledError. The
+// mails failed to be dead-lettered are returned by *domain.DeadLetterError.
+func (s *Service) DispatchMails(
+	ctx context.Context, mails []domain.Mail,
+) error {
+	const op = "Service.DispatchMails"
+	log := s.log.WithOp(op)
+
+	b := newBatch(len(mails))
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	for i, mail := range mails {
+		sem <- struct{}{}
+		if b.isThrottled() {
+			<-sem
+			for j := i; j < len(mails); j++ {
+				b.leave(j, 0)
+			}
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if d, ok := s.dispatch(ctx, b, mail); ok {
+				b.leave(i, d)
+			}
+		}()
+	}
+	wg.Wait()
+
+	pending := b.pendingMails(mails)
+	log.Debug().Int("nMails", len(mails)).Int(
+		"nPending", len(pending)).Msg("dispatched")
+
+	switch {
+	case len(pending) == 0:
+		return nil
+	case b.isThrottled():
+		return fmt.Errorf("%s: %w", op, &domain.ThrottledError{
+			RetryAfter: b.retryAfter, Pending: pending,
+		})
+	default:
+		return fmt.Errorf("%s: %w", op, &domain.DeadLetterError{
+			Err: b.deadLetterErr, Pending: pending,
+		})
+	}
+}
+
+func (s *Service) Stats(context.Context) domain.Stats {
+	return domain.Stats{
+		Sent:         s.nSent.Load(),
+		Failed:       s.nFailed.Load(),
+		Retried:      s.nRetried.Load(),
+		Throttled:    s.nThrottled.Load(),
+		DeadLettered: s.nDeadLetter.Load(),
+	}
+}
+
+// dispatch sends the mail with retries. It gives up once the batch is
+// throttled and reports the wait the notifier asked for, the mail is left
+// pending then. The mail failed to be dead-lettered is left pending too.
+func (s *Service) dispatch(
+	ctx context.Context, b *batch, mail domain.Mail,
+) (retryAfter time.Duration, pending bool) {
+	const op = "Service.dispatch"
+
+	if mail.RequestID != "" {
+		ctx = requestid.NewContext(ctx, mail.RequestID)
+	}
+	ctx, span := tracing.Start(ctx, "dispatch mail")
+	defer span.End()
+
+	log := s.log.WithOp(op).With().Str("uuid", mail.ReceiptUUID).Str(
+		"traceID", tracing.TraceID(ctx)).Str(
+		"requestID", mail.RequestID).Logger()
+
+	for attempt := 0; ; attempt++ {
+		err := s.sender.SendMail(ctx, mail)
+		if err == nil {
+			s.record(outcomeSent)
+			return 0, false
+		}
+
+		var throttledErr *domain.ThrottledError
+		if errors.As(err, &throttledErr) {
+			s.record(outcomeThrottled)
+			log.Warn().Err(err).Msg("mail is throttled")
+			b.throttle()
+			return throttledErr.RetryAfter, true
+		}
+
+		if ctx.Err() != nil {
+			s.record(outcomeFailed)
+			return 0, false
+		}
+
+		if attempt == s.maxRetries || errors.Is(err, domain.ErrRejected) {
+			s.record(outcomeFailed)
+			log.Error().Err(fmt.Errorf("%s: %w", op, err)).Int(
+				"attempts", attempt+1).Msg("failed to send mail")
+			span.RecordError(err)
+			if err := s.deadLetter(ctx, mail, err, attempt+1); err != nil {
+				log.Error().Err(err).Msg("failed to produce dead letter")
+				b.failDeadLetter(err)
+				return 0, true
+			}
+			return 0, false
+		}
+
+		if b.isThrottled() {
+			return 0, true
+		}
+
+		s.record(outcomeRetried)
+		log.Warn().Err(err).Int("attempt", attempt+1).Msg("retry sending mail")
+		switch sleep(ctx, b.throttled, backoff(attempt)) {
+		case sleepCanceled:
+			s.record(outcomeFailed)
+			return 0, false
+		case sleepThrottled:
+			return 0, true
+		}
+	}
+}
+
+func (s *Service) deadLetter(
+	ctx context.Context, mail domain.Mail, reason error, attempts int,
+) error {
+	const op = "Service.deadLetter"
+
+	err := s.dlq.ProduceDeadLetter(ctx, domain.DeadLetter{
+		Mail:     mail,
+		Reason:   reason.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.record(outcomeDeadLettered)
+	return nil
+}
+
+// record counts the delivery outcome.
+func (s *Service) record(outcome string) {
+	switch outcome {
+	case outcomeSent:
+		s.nSent.Add(1)
+	case outcomeFailed:
+		s.nFailed.Add(1)
+	case outcomeRetried:
+		s.nRetried.Add(1)
+	case outcomeThrottled:
+		s.nThrottled.Add(1)
+	case outcomeDeadLettered:
+		s.nDeadLetter.Add(1)
+	}
+	s.metrics.IncDelivery(outcome)
+}
+
+func backoff(attempt int) time.Duration {
+	if attempt >= retryMaxBackoffN {
+		return retryMaxDelay
+	}
+	return min(retryBaseDelay<<attempt, retryMaxDelay)
+}
+
+type sleepResult int
+
+const (
+	sleepDone sleepResult = iota
+	sleepCanceled
+	sleepThrottled
+)
+
+// sleep waits for the delay unless the context is done or the batch is
+// throttled meanwhile.
+func sleep(
+	ctx context.Context, throttled <-chan struct{}, d time.Duration,
+) sleepResult {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return sleepCanceled
+	case <-throttled:
+		return sleepThrottled
+	case <-timer.C:
+		return sleepDone
+	}
+}
+
+// batch tracks the mails left pending once the batch is throttled or the
+// dead letters are failed.
+type batch struct {
+	throttled     chan struct{}
+	once          sync.Once
+	mu            sync.Mutex
+	pending       []bool
+	retryAfter    time.Duration
+	deadLetterErr error
+}
+
+func newBatch(n int) *batch {
+	return &batch{
+		throttled: make(chan struct{}),
+		pending:   make([]bool, n),
+	}
+}
+
+func (b *batch) throttle() {
+	b.once.Do(func() { close(b.throttled) })
+}
+
+func (b *batch) isThrottled() bool {
+	select {
+	case <-b.throttled:
+		return true
+	default:
+		return false
+	}
+}
+
+// leave leaves the i-th mail pending, retryAfter is the wait the notifier
+// asked for.
+func (b *batch) leave(i int, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[i] = true
+	b.retryAfter = max(b.retryAfter, retryAfter)
+}
+
+func (b *batch) failDeadLetter(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.deadLetterErr == nil {
+		b.deadLetterErr = err
+	}
+}
+
+// pendingMails returns the pending mails in the batch order.
+func (b *batch) pendingMails(mails []domain.Mail) []domain.Mail {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var pending []domain.Mail
+	for i, mail := range mails {
+		if b.pending[i] {
+			pending = append(pending, mail)
+		}
+	}
+	return pending
+}
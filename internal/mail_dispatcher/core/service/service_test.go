@@ -0,0 +1,181 @@
+//go:build !integration
+
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/domain"
+	"github.com/niksmo/receipt/internal/mail_dispatcher/core/service"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flakySender struct {
+	mu         sync.Mutex
+	failures   map[string]int
+	retryAfter time.Duration
+	sent       []string
+}
+
+func (s *flakySender) SendMail(_ context.Context, mail domain.Mail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures[mail.ReceiptUUID] > 0 {
+		s.failures[mail.ReceiptUUID]--
+		if s.retryAfter != 0 {
+			return &domain.ThrottledError{RetryAfter: s.retryAfter}
+		}
+		return errors.New("notifier is unavailable")
+	}
+	s.sent = append(s.sent, mail.ReceiptUUID)
+	return nil
+}
+
+type noMetrics struct{}
+
+func (noMetrics) IncDelivery(string) {}
+
+type deadLetters struct {
+	mu    sync.Mutex
+	uuids []string
+	err   error
+}
+
+func (d *deadLetters) ProduceDeadLetter(
+	_ context.Context, dl domain.DeadLetter,
+) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	d.uuids = append(d.uuids, dl.Mail.ReceiptUUID)
+	return nil
+}
+
+func TestDispatchMails(t *testing.T) {
+	sender := &flakySender{failures: map[string]int{"b": 1, "c": 5}}
+	dlq := &deadLetters{}
+	s := service.NewService(
+		logger.New("disabled"), sender, dlq, noMetrics{}, 2, 1)
+
+	err := s.DispatchMails(context.Background(), []domain.Mail{
+		{ReceiptUUID: "a"}, {ReceiptUUID: "b"}, {ReceiptUUID: "c"},
+	})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"a", "b"}, sender.sent)
+	assert.Equal(t, []string{"c"}, dlq.uuids)
+	assert.Equal(t, domain.Stats{Sent: 2, Failed: 1, Retried: 2, DeadLettered: 1},
+		s.Stats(context.Background()))
+}
+
+func TestDispatchMailsThrottled(t *testing.T) {
+	t.Run("stops_batch", func(t *testing.T) {
+		sender := &flakySender{
+			failures:   map[string]int{"a": 1},
+			retryAfter: time.Second,
+		}
+		s := service.NewService(
+			logger.New("disabled"), sender, &deadLetters{}, noMetrics{}, 1, 1)
+
+		start := time.Now()
+		err := s.DispatchMails(context.Background(), []domain.Mail{
+			{ReceiptUUID: "a"}, {ReceiptUUID: "b"}, {ReceiptUUID: "c"},
+		})
+
+		var throttledErr *domain.ThrottledError
+		require.ErrorAs(t, err, &throttledErr)
+		assert.Equal(t, sender.retryAfter, throttledErr.RetryAfter)
+		assert.Equal(t, []domain.Mail{
+			{ReceiptUUID: "a"}, {ReceiptUUID: "b"}, {ReceiptUUID: "c"},
+		}, throttledErr.Pending)
+		assert.Less(t, time.Since(start), sender.retryAfter)
+		assert.Empty(t, sender.sent)
+		assert.Equal(t, int64(1), s.Stats(context.Background()).Throttled)
+	})
+
+	t.Run("interrupts_retries", func(t *testing.T) {
+		sender := &throttlingSender{
+			throttled: map[string]bool{"a": true},
+			unblock:   make(chan struct{}),
+		}
+		s := service.NewService(
+			logger.New("disabled"), sender, &deadLetters{}, noMetrics{}, 2, 10)
+
+		start := time.Now()
+		err := s.DispatchMails(context.Background(), []domain.Mail{
+			{ReceiptUUID: "a"}, {ReceiptUUID: "b"},
+		})
+
+		var throttledErr *domain.ThrottledError
+		require.ErrorAs(t, err, &throttledErr)
+		assert.ElementsMatch(t, []domain.Mail{
+			{ReceiptUUID: "a"}, {ReceiptUUID: "b"},
+		}, throttledErr.Pending)
+		// b is not retried with the backoff once a is throttled
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+// throttlingSender throttles the marked mails once the others failed, the
+// others keep failing.
+type throttlingSender struct {
+	throttled map[string]bool
+	unblock   chan struct{}
+	once      sync.Once
+}
+
+func (s *throttlingSender) SendMail(_ context.Context, mail domain.Mail) error {
+	if s.throttled[mail.ReceiptUUID] {
+		<-s.unblock
+		return &domain.ThrottledError{RetryAfter: time.Second}
+	}
+	s.once.Do(func() { close(s.unblock) })
+	return errors.New("notifier is unavailable")
+}
+
+func TestDispatchMailsRejected(t *testing.T) {
+	dlq := &deadLetters{}
+	sender := rejectingSender{}
+	s := service.NewService(
+		logger.New("disabled"), sender, dlq, noMetrics{}, 1, 3)
+
+	err := s.DispatchMails(
+		context.Background(), []domain.Mail{{ReceiptUUID: "a"}})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, dlq.uuids)
+	assert.Zero(t, s.Stats(context.Background()).Retried)
+}
+
+func TestDispatchMailsDeadLetterFailed(t *testing.T) {
+	dlq := &deadLetters{err: errors.New("broker is down")}
+	sender := &flakySender{failures: map[string]int{"b": 1}}
+	s := service.NewService(
+		logger.New("disabled"), sender, dlq, noMetrics{}, 2, 0)
+
+	err := s.DispatchMails(context.Background(), []domain.Mail{
+		{ReceiptUUID: "a"}, {ReceiptUUID: "b"},
+	})
+
+	var deadLetterErr *domain.DeadLetterError
+	require.ErrorAs(t, err, &deadLetterErr)
+	assert.ErrorIs(t, err, domain.ErrDeadLetter)
+	assert.Equal(t, []domain.Mail{{ReceiptUUID: "b"}}, deadLetterErr.Pending)
+	assert.Equal(t, []string{"a"}, sender.sent)
+	assert.Zero(t, s.Stats(context.Background()).DeadLettered)
+}
+
+type rejectingSender struct{}
+
+func (rejectingSender) SendMail(context.Context, domain.Mail) error {
+	return fmt.Errorf("status 400: %w", domain.ErrRejected)
+}
@@ -9,7 +9,9 @@ import (
 
 	"github.com/niksmo/receipt/internal/mock_notifier/core/domain"
 	"github.com/niksmo/receipt/internal/mock_notifier/core/port"
+	"github.com/niksmo/receipt/pkg/httpserver"
 	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/tracing"
 	"golang.org/x/time/rate"
 )
 
@@ -34,7 +36,7 @@ func (h SendMailHandler) SendMail(
 	w http.ResponseWriter, r *http.Request,
 ) {
 	const op = "SendMailHandler.SendMail"
-	log := h.log.WithOp(op)
+	log := h.log.Ctx(r.Context()).WithOp(op)
 
 	if !h.allow(w) {
 		log.Info().Msg("request limited")
@@ -44,6 +46,9 @@ func (h SendMailHandler) SendMail(
 	var data SendEmail
 	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
+		if httpserver.BodyTooLarge(w, log, err) {
+			return
+		}
 		errStr := "invalid JSON"
 		http.Error(w, errStr, http.StatusBadRequest)
 		log.Info().Err(err).Msg(errStr)
@@ -53,11 +58,13 @@ func (h SendMailHandler) SendMail(
 	msg, err := h.toDomain(data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		log.Info().Err(err).Msg(err.Error())
+		log.Info().Err(err).Msg("invalid message")
 		return
 	}
 
-	msgID, err := h.service.PrintMessage(r.Context(), msg)
+	ctx, span := tracing.Start(r.Context(), "print message")
+	msgID, err := h.service.PrintMessage(ctx, msg)
+	tracing.End(span, err)
 	if err != nil {
 		http.Error(w, "", http.StatusServiceUnavailable)
 		log.Error().Err(fmt.Errorf("%s: %w", op, err)).Msg("unexpected error")
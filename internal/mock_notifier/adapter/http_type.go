@@ -13,6 +13,7 @@ type SendEmail struct {
 	To          []SendTo `json:"to"`
 	Subject     string   `json:"subject"`
 	TextContent string   `json:"textContent"`
+	HTMLContent string   `json:"htmlContent,omitempty"`
 }
 
 type MessageCreated struct {
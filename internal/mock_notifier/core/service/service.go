@@ -30,8 +30,7 @@ func (s Service) PrintMessage(
 
 	msgID := domain.NewMessageID()
 
-	log.Debug().Str(
-		"to", msg.ToEmail).Str(
+	log.Debug().Func(logger.PII("to", msg.ToEmail)).Str(
 		"subject", msg.Subject).Str("messageID", msgID.String()).Send()
 
 	return msgID, nil
@@ -0,0 +1,33 @@
+//go:build !integration
+
+package adapter
+
+import (
+	"context"
+
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var FailureReason = failureReason
+
+func (p *KafkaProducer) RecordKey(rct domain.Receipt) []byte {
+	return p.recordKey(rct)
+}
+
+func (c *KafkaConsumer) RetrieveReceipts(
+	ctx context.Context, recs []*kgo.Record,
+) ([]domain.Receipt, error) {
+	crs, err := c.retrieveReceipts(ctx, recs)
+	rcts := make([]domain.Receipt, 0, len(crs))
+	for _, cr := range crs {
+		rcts = append(rcts, cr.receipt)
+	}
+	return rcts, err
+}
+
+func (c *KafkaConsumer) OutboxRecords(
+	ctx context.Context, mails []domain.Mail,
+) ([]*kgo.Record, error) {
+	return c.outboxRecords(ctx, mails)
+}
@@ -1,36 +1,74 @@
 package adapter
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/mail"
 
 	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
 	"github.com/niksmo/receipt/internal/receipt_service/core/port"
+	"github.com/niksmo/receipt/pkg/httpserver"
 	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/niksmo/receipt/pkg/middleware"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	// BatchPath is the only route accepting NDJSON.
+	BatchPath = "/v1/receipts:batch"
+
+	mediaTypeNDJSON   = "application/x-ndjson"
+	maxNDJSONLineSize = 1024 * 1024
+)
+
+var (
+	errBatchTooLarge = errors.New("batch size limit exceeded")
+	errBatchEmpty    = errors.New("empty batch")
 )
 
 type MailReceiptHandler struct {
-	log     logger.Logger
-	service port.EventSaver
+	log            logger.Logger
+	service        port.EventSaver
+	maxBatchSize   int
+	acceptedStatus int
 }
 
 func RegisterMailReceiptHandler(
-	log logger.Logger, mux *http.ServeMux, service port.EventSaver,
+	log logger.Logger,
+	mux *http.ServeMux,
+	service port.EventSaver,
+	maxBatchSize int,
+	async bool,
 ) {
-	h := MailReceiptHandler{log, service}
+	acceptedStatus := http.StatusCreated
+	if async {
+		acceptedStatus = http.StatusAccepted
+	}
+
+	h := MailReceiptHandler{log, service, maxBatchSize, acceptedStatus}
 	mux.HandleFunc("POST /v1/receipt", h.SendReceiptToMail)
+	mux.HandleFunc("POST "+BatchPath, h.SendReceiptsToMail)
 }
 
 func (h MailReceiptHandler) SendReceiptToMail(
 	w http.ResponseWriter, r *http.Request,
 ) {
 	const op = "MailReceiptHandler.SendReceiptToMail"
-	log := h.log.WithOp(op)
+	log := h.log.Ctx(r.Context()).WithOp(op)
 
 	var data Receipt
 	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
+		if httpserver.BodyTooLarge(w, log, err) {
+			return
+		}
 		errStr := "invalid json"
 		http.Error(w, errStr, http.StatusBadRequest)
 		log.Info().Err(err).Msg(errStr)
@@ -38,17 +76,175 @@ func (h MailReceiptHandler) SendReceiptToMail(
 	}
 
 	receipt := h.toDomain(data)
+	logger.AddStr(r.Context(), "uuid", receipt.UUID)
+
 	err = h.service.SaveEvent(r.Context(), receipt)
 	if err != nil {
+		if errors.Is(err, kgo.ErrMaxBuffered) {
+			w.Header().Set("Retry-After", "1")
+		}
 		http.Error(w, "", http.StatusServiceUnavailable)
 		log.Error().Err(fmt.Errorf("%s: %w", op, err)).Msg("unexpected error")
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Location", receiptStatusPath(receipt.UUID))
+	w.WriteHeader(h.acceptedStatus)
 	w.Write([]byte("Accept"))
 }
 
+func (h MailReceiptHandler) SendReceiptsToMail(
+	w http.ResponseWriter, r *http.Request,
+) {
+	const op = "MailReceiptHandler.SendReceiptsToMail"
+	log := h.log.Ctx(r.Context()).WithOp(op)
+
+	items, err := h.readBatch(r)
+	if err != nil {
+		if errors.Is(err, errBatchTooLarge) {
+			errStr := fmt.Sprintf("batch size limit is %d", h.maxBatchSize)
+			http.Error(w, errStr, http.StatusRequestEntityTooLarge)
+			log.Info().Err(err).Msg(errStr)
+			return
+		}
+		if httpserver.BodyTooLarge(w, log, err) {
+			return
+		}
+		errStr := "invalid json"
+		if errors.Is(err, errBatchEmpty) {
+			errStr = errBatchEmpty.Error()
+		}
+		http.Error(w, errStr, http.StatusBadRequest)
+		log.Info().Err(err).Msg(errStr)
+		return
+	}
+
+	metrics.ObserveBatchSize("http", len(items))
+
+	results := make([]BatchItemResult, len(items))
+	receipts := make([]domain.Receipt, 0, len(items))
+	indexes := make([]int, 0, len(items))
+	for i, item := range items {
+		results[i].Index = i
+
+		receipt, err := h.decodeBatchItem(item)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		receipts = append(receipts, receipt)
+		indexes = append(indexes, i)
+	}
+
+	errs := h.service.SaveEvents(r.Context(), receipts)
+	for i, err := range errs {
+		idx := indexes[i]
+		if err != nil {
+			results[idx].Error = "service unavailable"
+			if errors.Is(err, kgo.ErrMaxBuffered) {
+				w.Header().Set("Retry-After", "1")
+			}
+			log.Error().Err(fmt.Errorf("%s: %w", op, err)).Int(
+				"index", idx).Msg("unexpected error")
+			continue
+		}
+		results[idx].UUID = receipts[i].UUID
+	}
+
+	status := h.acceptedStatus
+	if len(receipts) != len(items) || errors.Join(errs...) != nil {
+		status = http.StatusMultiStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+func (h MailReceiptHandler) readBatch(
+	r *http.Request,
+) ([]json.RawMessage, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == mediaTypeNDJSON {
+		return h.readNDJSON(r)
+	}
+
+	// The array is decoded item by item, so decoding stops as soon as the
+	// limit is exceeded.
+	dec := json.NewDecoder(r.Body)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('[') {
+		return nil, errors.New("array expected")
+	}
+
+	var items []json.RawMessage
+	for dec.More() {
+		if len(items) == h.maxBatchSize {
+			return nil, errBatchTooLarge
+		}
+		var item json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("unexpected data after the array")
+	}
+	if len(items) == 0 {
+		return nil, errBatchEmpty
+	}
+	return items, nil
+}
+
+func (h MailReceiptHandler) readNDJSON(
+	r *http.Request,
+) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(nil, maxNDJSONLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(items) == h.maxBatchSize {
+			return nil, errBatchTooLarge
+		}
+		items = append(items, bytes.Clone(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errBatchEmpty
+	}
+	return items, nil
+}
+
+func (h MailReceiptHandler) decodeBatchItem(
+	item json.RawMessage,
+) (domain.Receipt, error) {
+	var data Receipt
+	if err := json.Unmarshal(item, &data); err != nil {
+		return domain.Receipt{}, errors.New("invalid json")
+	}
+	if err := h.validate(data); err != nil {
+		return domain.Receipt{}, err
+	}
+	return h.toDomain(data), nil
+}
+
 func (h MailReceiptHandler) toDomain(data Receipt) domain.Receipt {
 	r := domain.NewReceipt()
 	r.Number = data.Number
@@ -79,3 +275,129 @@ func (h MailReceiptHandler) toDomain(data Receipt) domain.Receipt {
 	}
 	return r
 }
+
+// validate rejects the batch items which would fail to be mailed, so the
+// rest of the batch is accepted.
+func (h MailReceiptHandler) validate(data Receipt) error {
+	if data.CustomerEmail == "" {
+		return errors.New("empty field: 'customer_email'")
+	}
+	if _, err := mail.ParseAddress(data.CustomerEmail); err != nil {
+		return errors.New("invalid field: 'customer_email'")
+	}
+	if data.Date.IsZero() {
+		return errors.New("empty field: 'date'")
+	}
+	if len(data.Products) == 0 {
+		return errors.New("empty field: 'products'")
+	}
+	return nil
+}
+
+type ReceiptStatusHandler struct {
+	log     logger.Logger
+	service port.StatusProvider
+}
+
+func RegisterReceiptStatusHandler(
+	log logger.Logger, mux *http.ServeMux, service port.StatusProvider,
+) {
+	h := ReceiptStatusHandler{log, service}
+	mux.HandleFunc("GET /v1/receipt/{uuid}/status", h.GetStatus)
+}
+
+func (h ReceiptStatusHandler) GetStatus(
+	w http.ResponseWriter, r *http.Request,
+) {
+	const op = "ReceiptStatusHandler.GetStatus"
+	log := h.log.Ctx(r.Context()).WithOp(op)
+
+	logger.AddStr(r.Context(), "uuid", r.PathValue("uuid"))
+	status, err := h.service.ReceiptStatus(r.Context(), r.PathValue("uuid"))
+	if err != nil {
+		if errors.Is(err, domain.ErrStatusNotFound) {
+			http.Error(w, "receipt not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "", http.StatusServiceUnavailable)
+		log.Error().Err(fmt.Errorf("%s: %w", op, err)).Msg("unexpected error")
+		return
+	}
+
+	res := ReceiptStatus{
+		UUID:      status.UUID,
+		Status:    string(status.Status),
+		Error:     string(status.Reason),
+		RequestID: status.RequestID,
+		UpdatedAt: status.UpdatedAt,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+type LagHandler struct {
+	log      logger.Logger
+	reporter port.LagReporter
+}
+
+// RegisterLagHandler registers the admin route authorized by the bearer
+// token. The route is not registered if the token is empty.
+func RegisterLagHandler(
+	log logger.Logger,
+	mux *http.ServeMux,
+	reporter port.LagReporter,
+	adminToken string,
+) {
+	if adminToken == "" {
+		log.Warn().Msg("admin token is not set, lag endpoint is disabled")
+		return
+	}
+	h := LagHandler{log, reporter}
+	mux.Handle("GET /v1/admin/lag",
+		middleware.BearerAuth(adminToken, http.HandlerFunc(h.GetLag)))
+}
+
+func (h LagHandler) GetLag(w http.ResponseWriter, r *http.Request) {
+	const op = "LagHandler.GetLag"
+	log := h.log.Ctx(r.Context()).WithOp(op)
+
+	report, err := h.reporter.LagReport(r.Context())
+	if err != nil {
+		if errors.Is(err, domain.ErrLagNotObserved) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "lag is not observed yet", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "", http.StatusServiceUnavailable)
+		log.Error().Err(fmt.Errorf("%s: %w", op, err)).Msg("unexpected error")
+		return
+	}
+
+	res := LagReport{
+		Group:         report.Group,
+		Topic:         report.Topic,
+		TotalLag:      report.TotalLag(),
+		MaxAgeSeconds: report.MaxAge().Seconds(),
+		Partitions:    make([]PartitionLag, 0, len(report.Partitions)),
+		ObservedAt:    report.ObservedAt,
+	}
+	for _, p := range report.Partitions {
+		pl := PartitionLag{
+			Partition:       p.Partition,
+			CommittedOffset: p.CommittedOffset,
+			EndOffset:       p.EndOffset,
+			Lag:             p.Lag,
+		}
+		if !p.AgeUnknown {
+			age := p.OldestAge.Seconds()
+			pl.OldestAgeSeconds = &age
+		}
+		res.Partitions = append(res.Partitions, pl)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func receiptStatusPath(uuid string) string {
+	return "/v1/receipt/" + uuid + "/status"
+}
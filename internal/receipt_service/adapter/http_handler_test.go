@@ -0,0 +1,286 @@
+//go:build !integration
+
+package adapter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/internal/receipt_service/adapter"
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+type eventSaver struct {
+	saved []domain.Receipt
+	err   error
+}
+
+func (s *eventSaver) SaveEvent(_ context.Context, rct domain.Receipt) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.saved = append(s.saved, rct)
+	return nil
+}
+
+func (s *eventSaver) SaveEvents(
+	_ context.Context, rcts []domain.Receipt,
+) []error {
+	s.saved = append(s.saved, rcts...)
+	return make([]error, len(rcts))
+}
+
+const validReceipt = `{"customer_email":"a@b.c","date":"2025-01-02T10:00:00Z",` +
+	`"products":[{"name":"tea","quantity":1}]}`
+
+func postBatch(
+	t *testing.T, maxBatchSize int, contentType string, body string,
+) (*httptest.ResponseRecorder, *eventSaver) {
+	t.Helper()
+	saver := &eventSaver{}
+	mux := http.NewServeMux()
+	adapter.RegisterMailReceiptHandler(
+		logger.New("disabled"), mux, saver, maxBatchSize, false)
+
+	req := httptest.NewRequest(
+		http.MethodPost, adapter.BatchPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec, saver
+}
+
+func TestSendReceiptToMail(t *testing.T) {
+	post := func(saver *eventSaver, async bool) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		adapter.RegisterMailReceiptHandler(
+			logger.New("disabled"), mux, saver, 10, async)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(
+			http.MethodPost, "/v1/receipt", strings.NewReader(validReceipt)))
+		return rec
+	}
+
+	t.Run("sync", func(t *testing.T) {
+		rec := post(&eventSaver{}, false)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("async", func(t *testing.T) {
+		rec := post(&eventSaver{}, true)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Location"))
+	})
+
+	t.Run("buffer_full", func(t *testing.T) {
+		saver := &eventSaver{
+			err: fmt.Errorf("produce: %w", kgo.ErrMaxBuffered),
+		}
+		rec := post(saver, true)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	})
+}
+
+func TestSendReceiptsToMail(t *testing.T) {
+	t.Run("item_results", func(t *testing.T) {
+		rec, saver := postBatch(t, 10, "application/json", `[`+
+			validReceipt+`,{"customer_email":"not-an-email"},42]`)
+		require.Equal(t, http.StatusMultiStatus, rec.Code)
+
+		var res []adapter.BatchItemResult
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		require.Len(t, res, 3)
+		assert.NotEmpty(t, res[0].UUID)
+		assert.Empty(t, res[0].Error)
+		assert.Equal(t, "invalid field: 'customer_email'", res[1].Error)
+		assert.Equal(t, "invalid json", res[2].Error)
+		assert.Len(t, saver.saved, 1)
+	})
+
+	t.Run("size_limit", func(t *testing.T) {
+		// The malformed tail is never decoded.
+		rec, saver := postBatch(t, 2, "application/json",
+			`[`+validReceipt+`,`+validReceipt+`,`+validReceipt+`,{bad`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Empty(t, saver.saved)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		rec, saver := postBatch(t, 10, "application/x-ndjson",
+			validReceipt+"\n\n"+validReceipt+"\n")
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Len(t, saver.saved, 2)
+	})
+
+	t.Run("trailing_data", func(t *testing.T) {
+		rec, saver := postBatch(t, 10, "application/json",
+			`[`+validReceipt+`] garbage`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Empty(t, saver.saved)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		for contentType, body := range map[string]string{
+			"application/json":     `[]`,
+			"application/x-ndjson": "\n\n",
+		} {
+			rec, _ := postBatch(t, 10, contentType, body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, contentType)
+			assert.Equal(t, "empty batch\n", rec.Body.String(), contentType)
+		}
+	})
+
+	t.Run("ndjson_with_params", func(t *testing.T) {
+		rec, saver := postBatch(t, 10, "application/x-ndjson; charset=utf-8",
+			validReceipt+"\n"+validReceipt+"\n")
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Len(t, saver.saved, 2)
+	})
+
+	t.Run("ndjson_size_limit", func(t *testing.T) {
+		rec, _ := postBatch(t, 1, "application/x-ndjson",
+			validReceipt+"\n"+validReceipt+"\n")
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
+
+type statusProvider struct {
+	status domain.ReceiptStatus
+	err    error
+}
+
+func (p statusProvider) ReceiptStatus(
+	context.Context, string,
+) (domain.ReceiptStatus, error) {
+	return p.status, p.err
+}
+
+func getStatus(
+	t *testing.T, provider statusProvider,
+) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	adapter.RegisterReceiptStatusHandler(logger.New("disabled"), mux, provider)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(
+		http.MethodGet, "/v1/receipt/a/status", nil))
+	return rec
+}
+
+func TestGetStatus(t *testing.T) {
+	t.Run("failed", func(t *testing.T) {
+		status := domain.NewFailedStatus("a", domain.ReasonTimeout)
+		rec := getStatus(t, statusProvider{status: status})
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res adapter.ReceiptStatus
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		assert.Equal(t, "a", res.UUID)
+		assert.Equal(t, "failed", res.Status)
+		assert.Equal(t, "timeout", res.Error)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		rec := getStatus(t, statusProvider{err: domain.ErrStatusNotFound})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		rec := getStatus(t, statusProvider{err: errors.New("store is down")})
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
+
+type lagReporter struct {
+	report domain.LagReport
+	err    error
+}
+
+func (r lagReporter) LagReport(context.Context) (domain.LagReport, error) {
+	return r.report, r.err
+}
+
+const testAdminToken = "admin-token"
+
+func getLag(
+	t *testing.T, reporter lagReporter, token string,
+) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	adapter.RegisterLagHandler(
+		logger.New("disabled"), mux, reporter, testAdminToken)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/lag", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetLag(t *testing.T) {
+	t.Run("report", func(t *testing.T) {
+		rec := getLag(t, lagReporter{
+			report: domain.LagReport{
+				Group: "mail-group",
+				Topic: "mail-receipt",
+				Partitions: []domain.PartitionLag{
+					{Partition: 0, CommittedOffset: 10, EndOffset: 10},
+					{
+						Partition: 1, CommittedOffset: 5, EndOffset: 12,
+						Lag: 7, OldestAge: 90 * time.Second,
+					},
+					{
+						Partition: 2, CommittedOffset: 3, EndOffset: 4,
+						Lag: 1, AgeUnknown: true,
+					},
+				},
+			},
+		}, testAdminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res adapter.LagReport
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		assert.Equal(t, int64(8), res.TotalLag)
+		assert.Equal(t, 90.0, res.MaxAgeSeconds)
+		require.Len(t, res.Partitions, 3)
+		require.NotNil(t, res.Partitions[0].OldestAgeSeconds)
+		assert.Zero(t, *res.Partitions[0].OldestAgeSeconds)
+		assert.Nil(t, res.Partitions[2].OldestAgeSeconds)
+	})
+
+	t.Run("not_observed", func(t *testing.T) {
+		rec := getLag(t, lagReporter{
+			err: domain.ErrLagNotObserved,
+		}, testAdminToken)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := getLag(t, lagReporter{}, "other-token")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		mux := http.NewServeMux()
+		adapter.RegisterLagHandler(logger.New("disabled"), mux, lagReporter{}, "")
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(
+			rec, httptest.NewRequest(http.MethodGet, "/v1/admin/lag", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -26,3 +26,35 @@ type Receipt struct {
 	FiscalAttribute    string    `json:"fiscal_attribute"`     // ФПД
 	Products           []Product `json:"products"`
 }
+
+type BatchItemResult struct {
+	Index int    `json:"index"`
+	UUID  string `json:"uuid,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type ReceiptStatus struct {
+	UUID      string    `json:"uuid"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PartitionLag struct {
+	Partition       int32 `json:"partition"`
+	CommittedOffset int64 `json:"committed_offset"`
+	EndOffset       int64 `json:"end_offset"`
+	Lag             int64 `json:"lag"`
+	// OldestAgeSeconds is null if the age is unknown.
+	OldestAgeSeconds *float64 `json:"oldest_age_seconds"`
+}
+
+type LagReport struct {
+	Group         string         `json:"group"`
+	Topic         string         `json:"topic"`
+	TotalLag      int64          `json:"total_lag"`
+	MaxAgeSeconds float64        `json:"max_age_seconds"`
+	Partitions    []PartitionLag `json:"partitions"`
+	ObservedAt    time.Time      `json:"observed_at"`
+}
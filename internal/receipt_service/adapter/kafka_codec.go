@@ -0,0 +1,180 @@
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	receiptv1 "github.com/niksmo/receipt/api/receipt/v1"
+	"github.com/niksmo/receipt/config"
+	"github.com/niksmo/receipt/pkg/schemaregistry"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const contentTypeProtobuf = "application/x-protobuf"
+
+// Codec encodes receipt events to the record value. The content type and
+// schema version are written to the record headers, so the consumer is able
+// to pick the matching codec.
+type Codec interface {
+	ContentType() string
+	SchemaVersion() string
+	Schema() schemaregistry.Schema
+	// MessageIndexes returns the protobuf message indexes written after the
+	// schema ID in the schema registry wire format, nil for other encodings.
+	MessageIndexes() []int
+	Encode(ReceiptRequestedV1) ([]byte, error)
+	Decode([]byte) (ReceiptRequestedV1, error)
+}
+
+func NewCodec(name config.Codec) Codec {
+	if name == config.CodecProtobuf {
+		return ProtobufCodec{}
+	}
+	return JSONCodec{}
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return contentTypeJSON
+}
+
+func (JSONCodec) SchemaVersion() string {
+	return schemaVersionV1
+}
+
+func (JSONCodec) Schema() schemaregistry.Schema {
+	return schemaregistry.Schema{
+		Type:   schemaregistry.TypeJSON,
+		Schema: receiptv1.JSONSchema,
+	}
+}
+
+func (JSONCodec) MessageIndexes() []int {
+	return nil
+}
+
+func (JSONCodec) Encode(evt ReceiptRequestedV1) ([]byte, error) {
+	const op = "JSONCodec.Encode"
+
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return b, nil
+}
+
+func (JSONCodec) Decode(b []byte) (ReceiptRequestedV1, error) {
+	const op = "JSONCodec.Decode"
+
+	var evt ReceiptRequestedV1
+	if err := json.Unmarshal(b, &evt); err != nil {
+		return ReceiptRequestedV1{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return evt, nil
+}
+
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string {
+	return contentTypeProtobuf
+}
+
+func (ProtobufCodec) SchemaVersion() string {
+	return schemaVersionV1
+}
+
+func (ProtobufCodec) Schema() schemaregistry.Schema {
+	return schemaregistry.Schema{
+		Type:   schemaregistry.TypeProtobuf,
+		Schema: receiptv1.ProtoSchema,
+	}
+}
+
+func (ProtobufCodec) MessageIndexes() []int {
+	return []int{receiptv1.ReceiptRequestedIndex}
+}
+
+func (ProtobufCodec) Encode(evt ReceiptRequestedV1) ([]byte, error) {
+	const op = "ProtobufCodec.Encode"
+
+	_, offset := evt.Date.Zone()
+	msg := &receiptv1.ReceiptRequested{
+		Uuid:               evt.UUID,
+		Number:             int64(evt.Number),
+		Date:               timestamppb.New(evt.Date),
+		DateOffset:         int32(offset),
+		Organization:       evt.Organization,
+		PaymentAddress:     evt.PaymentAddress,
+		TaxpayerNumber:     evt.TaxpayerNumber,
+		TaxationType:       evt.TaxationType,
+		CalculationSign:    evt.CalculationSign,
+		CustomerEmail:      evt.CustomerEmail,
+		FiscalDeviceNumber: evt.FiscalDeviceNumber,
+		CashRegisterNumber: evt.CashRegisterNumber,
+		FiscalDocument:     evt.FiscalDocument,
+		FiscalAttribute:    evt.FiscalAttribute,
+	}
+	for _, p := range evt.Products {
+		msg.Products = append(msg.Products, &receiptv1.Product{
+			Name:       p.Name,
+			Quantity:   int64(p.Quantity),
+			UnitPrice:  int64(p.UnitPrice),
+			TotalPrice: int64(p.TotalPrice),
+			TaxRate:    p.TaxRate,
+			TaxValue:   int64(p.TaxValue),
+		})
+	}
+
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return b, nil
+}
+
+func (ProtobufCodec) Decode(b []byte) (ReceiptRequestedV1, error) {
+	const op = "ProtobufCodec.Decode"
+
+	var msg receiptv1.ReceiptRequested
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		return ReceiptRequestedV1{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	evt := ReceiptRequestedV1{
+		UUID:               msg.GetUuid(),
+		Number:             int(msg.GetNumber()),
+		Date:               protoDate(&msg),
+		Organization:       msg.GetOrganization(),
+		PaymentAddress:     msg.GetPaymentAddress(),
+		TaxpayerNumber:     msg.GetTaxpayerNumber(),
+		TaxationType:       msg.GetTaxationType(),
+		CalculationSign:    msg.GetCalculationSign(),
+		CustomerEmail:      msg.GetCustomerEmail(),
+		FiscalDeviceNumber: msg.GetFiscalDeviceNumber(),
+		CashRegisterNumber: msg.GetCashRegisterNumber(),
+		FiscalDocument:     msg.GetFiscalDocument(),
+		FiscalAttribute:    msg.GetFiscalAttribute(),
+	}
+	for _, p := range msg.GetProducts() {
+		evt.Products = append(evt.Products, ProductV1{
+			Name:       p.GetName(),
+			Quantity:   int(p.GetQuantity()),
+			UnitPrice:  int(p.GetUnitPrice()),
+			TotalPrice: int(p.GetTotalPrice()),
+			TaxRate:    p.GetTaxRate(),
+			TaxValue:   int(p.GetTaxValue()),
+		})
+	}
+	return evt, nil
+}
+
+func protoDate(msg *receiptv1.ReceiptRequested) time.Time {
+	date := msg.GetDate().AsTime()
+	if offset := int(msg.GetDateOffset()); offset != 0 {
+		date = date.In(time.FixedZone("", offset))
+	}
+	return date
+}
@@ -0,0 +1,61 @@
+//go:build !integration
+
+package adapter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/internal/receipt_service/adapter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var codecs = map[string]adapter.Codec{
+	"json":     adapter.JSONCodec{},
+	"protobuf": adapter.ProtobufCodec{},
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	rct := testReceipt()
+	rct.Date = rct.Date.In(time.FixedZone("", 3*60*60))
+	evt := adapter.NewReceiptRequestedV1(rct)
+
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			b, err := codec.Encode(evt)
+			require.NoError(t, err)
+
+			actual, err := codec.Decode(b)
+			require.NoError(t, err)
+			assert.Equal(t, evt, actual)
+		})
+	}
+}
+
+func BenchmarkCodec(b *testing.B) {
+	evt := adapter.NewReceiptRequestedV1(testReceipt())
+
+	for name, codec := range codecs {
+		v, err := codec.Encode(evt)
+		require.NoError(b, err)
+
+		b.Run(name+"/encode", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				_, _ = codec.Encode(evt)
+			}
+			b.ReportMetric(float64(len(v)), "bytes/record")
+			b.SetBytes(int64(len(v)))
+		})
+
+		b.Run(name+"/decode", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				_, _ = codec.Decode(v)
+			}
+			b.ReportMetric(float64(len(v)), "bytes/record")
+			b.SetBytes(int64(len(v)))
+		})
+	}
+}
@@ -5,44 +5,137 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/niksmo/receipt/config"
 	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
 	"github.com/niksmo/receipt/internal/receipt_service/core/port"
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
 	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/niksmo/receipt/pkg/schemaregistry"
+	"github.com/niksmo/receipt/pkg/tracing"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	fetchMinBytes = 20 * 1024
 	fetchMaxWait  = 2 * time.Second
+	// partitionQueueLen disables the backlog pause: the poll waits for every
+	// submitted batch, so a partition never has more than one.
+	partitionQueueLen = 0
 )
 
+type schemaKey struct {
+	contentType   string
+	schemaVersion string
+}
+
+type consumedReceipt struct {
+	receipt domain.Receipt
+	// recCtx carries the trace context and the request ID of the record.
+	recCtx context.Context
+}
+
+// KafkaConsumer renders the consumed receipts and produces the mails to the
+// outbox topic. Producing and committing the consumed offsets happen in one
+// transaction, so each receipt results in exactly one outbox record.
+//
+// The batches of a poll are handled by the partition workers concurrently,
+// but a session has a single transaction: it commits the offsets of every
+// polled partition, so it ends and the next poll starts once the slowest
+// batch is done. A slow batch holds the next poll of the other partitions.
 type KafkaConsumer struct {
-	log    logger.Logger
-	kcl    *kgo.Client
-	ep     port.EventProcessor
-	nRecs  atomic.Int64
-	nBytes atomic.Int64
+	log         logger.Logger
+	sess        *kgo.GroupTransactSession
+	topic       string
+	outboxTopic string
+	ep          port.EventProcessor
+	codecs      map[schemaKey]Codec
+	registry    schemaregistry.Registry
+	keyring     *fieldcrypt.Keyring
+	schemas     sync.Map // schema ID -> schemaregistry.Schema
+	nRecs       atomic.Int64
+	nBytes      atomic.Int64
+	workers     *kafkaclient.Workers
+	// workCtx outlives the Run context, so the current batch is finished
+	// on shutdown. It is canceled when the drain deadline is exceeded.
+	workCtx    context.Context
+	cancelWork context.CancelFunc
+	done       chan struct{}
 }
 
+// NewKafkaConsumer creates the consumer. The registry is optional, it is
+// required to decode records framed in the schema registry wire format. The
+// keyring is required to decode records with encrypted fields, the mails are
+// encrypted on the outbox topic when it is set.
 func NewKafkaConsumer(
 	log logger.Logger,
-	seedBrokers []string, topic string, group string, ep port.EventProcessor,
+	cfg config.BrokerConfig,
+	ep port.EventProcessor,
+	registry schemaregistry.Registry,
+	keyring *fieldcrypt.Keyring,
 ) *KafkaConsumer {
-	kcl, err := kgo.NewClient(
-		kgo.SeedBrokers(seedBrokers...),
-		kgo.DisableAutoCommit(),
-		kgo.ConsumeTopics(topic),
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	c := &KafkaConsumer{
+		log:         log,
+		topic:       cfg.Topic,
+		outboxTopic: cfg.OutboxTopic,
+		ep:          ep,
+		registry:    registry,
+		keyring:     keyring,
+		workCtx:     workCtx,
+		cancelWork:  cancelWork,
+		done:        make(chan struct{}),
+	}
+	c.workers = kafkaclient.NewWorkers(
+		workCtx, log, partitionQueueLen, c.handle)
+
+	opts, err := kafkaclient.Opts(cfg.SeedBrokers, cfg.Security)
+	if err != nil {
+		panic(err) // validated on config load
+	}
+
+	// The rebalance waits until the transaction of the polled batch ends,
+	// so the offsets of the revoked partitions are committed with it and the
+	// new owner does not process them again.
+	opts = append(opts,
+		kgo.TransactionalID(cfg.TransactionalID),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.RequireStableFetchOffsets(),
+		kgo.ConsumeTopics(cfg.Topic),
 		kgo.FetchMinBytes(fetchMinBytes),
 		kgo.FetchMaxWait(fetchMaxWait),
-		kgo.ConsumerGroup(group),
+		kgo.ConsumerGroup(cfg.ConsumerGroup),
+		kgo.Balancers(cfg.Balancer.GroupBalancer()),
+		kgo.BlockRebalanceOnPoll(),
+		kgo.OnPartitionsAssigned(c.workers.Assigned),
+		kgo.OnPartitionsRevoked(c.workers.Revoked),
+		kgo.OnPartitionsLost(c.workers.Lost),
+		kgo.DefaultProduceTopic(cfg.OutboxTopic),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.ProducerBatchMaxBytes(maxBatchSize),
 	)
+	if cfg.InstanceID != "" {
+		opts = append(opts, kgo.InstanceID(cfg.InstanceID))
+	}
+
+	c.sess, err = kgo.NewGroupTransactSession(opts...)
 	if err != nil {
 		panic(err) // developer mistake
 	}
-	return &KafkaConsumer{log: log, kcl: kcl, ep: ep}
+	c.codecs = make(map[schemaKey]Codec)
+	for _, codec := range []Codec{JSONCodec{}, ProtobufCodec{}} {
+		c.codecs[schemaKey{codec.ContentType(), codec.SchemaVersion()}] = codec
+	}
+	return c
 }
 
 func (c *KafkaConsumer) Run(ctx context.Context) {
@@ -50,6 +143,7 @@ func (c *KafkaConsumer) Run(ctx context.Context) {
 	log := c.log.WithOp(op)
 
 	log.Info().Msg("kafka consumer is running")
+	defer close(c.done)
 
 	go c.capacity(ctx)
 
@@ -58,40 +152,161 @@ func (c *KafkaConsumer) Run(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		default:
-			c.consume(ctx)
+			if err := c.consume(ctx); err != nil {
+				log.Error().Err(err).Msg("consumer is stopped")
+				return
+			}
 		}
 	}
 }
 
+// Shutdown waits until Run finishes the current batch and then leaves the
+// group. The batch is aborted if the context is done first.
+func (c *KafkaConsumer) Shutdown(ctx context.Context) {
+	const op = "KafkaConsumer.Shutdown"
+	log := c.log.WithOp(op)
+
+	log.Info().Msg("draining consumer")
+	select {
+	case <-c.done:
+		log.Info().Msg("consumer is drained")
+	case <-ctx.Done():
+		log.Warn().Msg("drain deadline exceeded, aborting current batch")
+		c.cancelWork()
+		<-c.done
+	}
+	c.Close()
+}
+
 func (c *KafkaConsumer) Close() {
 	const op = "KafkaConsumer.Close"
 	log := c.log.WithOp(op)
 
 	log.Info().Msg("closing consumer")
-	c.kcl.Close()
+	c.cancelWork()
+	c.workers.Close()
+	c.sess.Close()
 	log.Info().Msg("consumer is closed")
 }
 
-func (c *KafkaConsumer) consume(ctx context.Context) {
+func (c *KafkaConsumer) InitOutboxTopic(
+	ctx context.Context, partitions int, repFactor int, onFall func(err error),
+) {
+	const op = "KafkaConsumer.InitOutboxTopic"
+	log := c.log.WithOp(op)
+
+	err := kafkaclient.CreateTopic(
+		ctx, log, c.sess.Client(), c.outboxTopic, partitions, repFactor)
+	if err != nil {
+		onFall(fmt.Errorf("%s: %w", op, err))
+	}
+}
+
+func (c *KafkaConsumer) CheckOutboxTopic(ctx context.Context) error {
+	const op = "KafkaConsumer.CheckOutboxTopic"
+
+	if err := kafkaclient.CheckTopics(ctx, c.sess.Client(), c.outboxTopic); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (c *KafkaConsumer) CheckGroup(context.Context) error {
+	const op = "KafkaConsumer.CheckGroup"
+
+	if err := kafkaclient.CheckGroup(c.sess.Client()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// consume handles a single poll. It returns an error if the consumer must
+// stop: the records the keyring cannot decrypt are not skipped, so they are
+// not lost, and the transaction is aborted.
+func (c *KafkaConsumer) consume(ctx context.Context) error {
 	const op = "KafkaConsumer.consume"
 	log := c.log.WithOp(op)
 
 	fetches, err := c.pollFetches(ctx)
+	defer c.sess.AllowRebalance()
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			log.Info().Msg("interrupted")
-			return
+			return nil
 		}
 		log.Error().Err(err).Msg("failed to poll fetches")
-		return
+		return nil
 	}
 
-	rcts := c.retrieveReceipts(fetches)
-	if !c.isReceipts(rcts) {
-		return
+	if fetches.Empty() {
+		return nil
+	}
+
+	if err := c.sess.Begin(); err != nil {
+		log.Error().Err(err).Msg("failed to begin transaction")
+		return nil
+	}
+
+	// the polled batch is finished even if Run is canceled meanwhile
+	err = c.handlePartitions(fetches)
+	c.endTransaction(c.workCtx, err)
+	if fieldcrypt.IsMissingKey(err) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// handlePartitions hands the batch of each partition to its worker and waits
+// until all of them are done. The transaction commits the offsets of every
+// polled partition, so it must not end before the slowest one.
+func (c *KafkaConsumer) handlePartitions(fetches kgo.Fetches) error {
+	const op = "KafkaConsumer.handlePartitions"
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	done := func(err error) {
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}
+		wg.Done()
+	}
+
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+		wg.Add(1)
+		if !c.workers.Submit(p, done) {
+			done(fmt.Errorf(
+				"topic %q partition %d is not assigned", p.Topic, p.Partition))
+		}
+	})
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
-	c.handleReceipts(ctx, rcts)
-	c.commitOffset(ctx)
+	return nil
+}
+
+// handle renders the receipts of a single partition batch and produces the
+// mails within the current transaction.
+func (c *KafkaConsumer) handle(
+	ctx context.Context, _ *kafkaclient.PartitionWorker, recs []*kgo.Record,
+) error {
+	crs, err := c.retrieveReceipts(ctx, recs)
+	if err != nil {
+		return err
+	}
+	if !c.isReceipts(crs) {
+		return nil
+	}
+	return c.handleReceipts(crs)
 }
 
 func (c *KafkaConsumer) capacity(ctx context.Context) {
@@ -118,7 +333,7 @@ func (c *KafkaConsumer) pollFetches(ctx context.Context) (kgo.Fetches, error) {
 	log := c.log.WithOp(op)
 
 	log.Debug().Msg("start polling")
-	fetches := c.kcl.PollFetches(ctx)
+	fetches := c.sess.PollFetches(ctx)
 	log.Debug().Msg("complete polling")
 	err := fetches.Err0()
 	if errors.Is(err, context.Canceled) {
@@ -139,58 +354,286 @@ func (c *KafkaConsumer) pollFetches(ctx context.Context) (kgo.Fetches, error) {
 
 	recs := int64(fetches.NumRecords())
 	c.nRecs.Add(recs)
+	metrics.ObserveBatchSize("consume", int(recs))
+	kafkaclient.ObserveLag(c.sess.Client(), fetches)
 	log.Debug().Int64("nRecord", recs).Send()
 	return fetches, nil
 }
 
+// retrieveReceipts skips the records failed to decode. It returns an error
+// if a record cannot be decrypted with the keyring.
 func (c *KafkaConsumer) retrieveReceipts(
-	fetches kgo.Fetches,
-) []domain.Receipt {
+	ctx context.Context, recs []*kgo.Record,
+) ([]consumedReceipt, error) {
 	const op = "KafkaConsumer.retrieveReceipts"
 	log := c.log.WithOp(op)
 
-	var rcts []domain.Receipt
-	fetches.EachRecord(func(rec *kgo.Record) {
+	var crs []consumedReceipt
+	for _, rec := range recs {
 		c.nBytes.Add(int64(len(rec.Value)))
-		rct, err := c.unmarshalReceipt(rec.Value)
+		meta, err := readMeta(rec)
 		if err != nil {
-			log.Error().Err(err).Msg("failed to unmarshal record value")
-			return
+			log.Error().Err(err).Int64(
+				"offset", rec.Offset).Msg("failed to read record headers")
+			continue
 		}
-		rcts = append(rcts, rct)
-	})
-	log.Debug().Int("nReceipts", len(rcts)).Send()
+		recCtx := tracing.Extract(ctx, tracing.RecordCarrier{Record: rec})
+		if meta.RequestID != "" {
+			recCtx = requestid.NewContext(recCtx, meta.RequestID)
+		}
+		recLog := log.With().Str(
+			"traceID", tracing.TraceID(recCtx)).Str(
+			"requestID", meta.RequestID).Str(
+			"uuid", meta.ReceiptUUID).Logger()
+
+		codec, ok := c.codecs[schemaKey{meta.ContentType, meta.SchemaVersion}]
+		if !ok {
+			recLog.Error().Str("contentType", meta.ContentType).Str(
+				"schemaVersion", meta.SchemaVersion).Msg("unsupported record schema")
+			continue
+		}
+
+		rct, err := c.unmarshalReceipt(ctx, codec, rec)
+		if fieldcrypt.IsMissingKey(err) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err != nil {
+			recLog.Error().Err(err).Msg("failed to unmarshal record value")
+			continue
+		}
+		recLog.Debug().Msg("receipt retrieved")
+		crs = append(crs, consumedReceipt{rct, recCtx})
+	}
+	log.Debug().Int("nReceipts", len(crs)).Send()
 
-	return rcts
+	return crs, nil
 }
 
-func (c *KafkaConsumer) unmarshalReceipt(b []byte) (domain.Receipt, error) {
+func (c *KafkaConsumer) unmarshalReceipt(
+	ctx context.Context, codec Codec, rec *kgo.Record,
+) (domain.Receipt, error) {
 	const op = "KafkaConsumer.unmarshalReceipt"
 
-	var rct domain.Receipt
-	err := json.Unmarshal(b, &rct)
+	b, err := c.unframe(ctx, codec, rec.Value)
 	if err != nil {
 		return domain.Receipt{}, fmt.Errorf("%s: %w", op, err)
 	}
-	return rct, nil
+
+	evt, err := codec.Decode(b)
+	if err != nil {
+		return domain.Receipt{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The keyring keeps the rotated keys, so the records encrypted before
+	// the rotation are decrypted as well.
+	err = fieldcrypt.DecryptRecord(c.keyring, rec, evt.UUID, map[string]*string{
+		encFieldCustomerEmail: &evt.CustomerEmail,
+	})
+	if err != nil {
+		return domain.Receipt{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return evt.ToDomain(), nil
 }
 
-func (c *KafkaConsumer) isReceipts(rcts []domain.Receipt) bool {
-	return len(rcts) != 0
+// unframe strips the schema registry wire format header, if any, and checks
+// the registered schema matches the codec.
+func (c *KafkaConsumer) unframe(
+	ctx context.Context, codec Codec, b []byte,
+) ([]byte, error) {
+	const op = "KafkaConsumer.unframe"
+
+	if !schemaregistry.IsFramed(b) {
+		return b, nil
+	}
+
+	id, b, err := schemaregistry.ParseHeader(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	schema, err := c.schemaByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if schema.Type != codec.Schema().Type {
+		return nil, fmt.Errorf(
+			"%s: schema %d type %q does not match content type %q",
+			op, id, schema.Type, codec.ContentType(),
+		)
+	}
+
+	if indexes := codec.MessageIndexes(); indexes != nil {
+		var actual []int
+		actual, b, err = schemaregistry.ParseMessageIndexes(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !slices.Equal(indexes, actual) {
+			return nil, fmt.Errorf(
+				"%s: unexpected message indexes %v", op, actual)
+		}
+	}
+	return b, nil
 }
 
-func (c *KafkaConsumer) handleReceipts(
-	ctx context.Context, rcts []domain.Receipt,
-) {
-	c.ep.ProcessEvent(ctx, rcts)
+// schemaByID returns the schema from the cache or the registry.
+func (c *KafkaConsumer) schemaByID(
+	ctx context.Context, id int,
+) (schemaregistry.Schema, error) {
+	const op = "KafkaConsumer.schemaByID"
+
+	if s, ok := c.schemas.Load(id); ok {
+		return s.(schemaregistry.Schema), nil
+	}
+
+	if c.registry == nil {
+		return schemaregistry.Schema{}, fmt.Errorf(
+			"%s: schema registry is not configured", op)
+	}
+
+	s, err := c.registry.SchemaByID(ctx, id)
+	if err != nil {
+		return schemaregistry.Schema{}, fmt.Errorf("%s: %w", op, err)
+	}
+	c.schemas.Store(id, s)
+	return s, nil
+}
+
+func (c *KafkaConsumer) isReceipts(crs []consumedReceipt) bool {
+	return len(crs) != 0
+}
+
+// handleReceipts processes each receipt in the consumer span continuing the
+// trace of its record, so the trace of the mail is continued as well. The
+// span ends once the outbox records of the receipt are produced, only the
+// receipt that failed is recorded with the error.
+func (c *KafkaConsumer) handleReceipts(crs []consumedReceipt) error {
+	const op = "KafkaConsumer.handleReceipts"
+
+	promise := kgo.AbortingFirstErrPromise(c.sess.Client())
+	for _, cr := range crs {
+		ctx, span := tracing.Start(cr.recCtx, "process "+c.topic,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination.name", c.topic),
+			),
+		)
+
+		mails := c.ep.ProcessEvent(ctx, []domain.Receipt{cr.receipt})
+		if err := c.produceOutbox(ctx, mails, span, promise); err != nil {
+			tracing.End(span, err)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := promise.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// produceOutbox produces the mails within the current transaction and ends
+// the span once all of them are produced. The records aborted because of
+// another failed record do not mark the span as failed.
+func (c *KafkaConsumer) produceOutbox(
+	ctx context.Context,
+	mails []domain.Mail,
+	span trace.Span,
+	promise *kgo.FirstErrPromise,
+) error {
+	const op = "KafkaConsumer.produceOutbox"
+
+	recs, err := c.outboxRecords(ctx, mails)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(recs) == 0 {
+		span.End()
+		return nil
+	}
+
+	var (
+		mu      sync.Mutex
+		pending = len(recs)
+		errs    []error
+	)
+	for _, kr := range recs {
+		start := time.Now()
+		promiseFn := promise.Promise()
+		c.sess.Produce(ctx, kr, func(r *kgo.Record, err error) {
+			metrics.ObserveProduce(c.outboxTopic, start, err)
+			promiseFn(r, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, kgo.ErrAborting):
+				span.AddEvent("aborted with the transaction")
+			case err != nil:
+				errs = append(errs, err)
+			}
+			if pending--; pending == 0 {
+				tracing.End(span, errors.Join(errs...))
+			}
+		})
+	}
+	return nil
 }
 
-func (c *KafkaConsumer) commitOffset(ctx context.Context) {
-	const op = "KafkaConsumer.commitOffset"
+// outboxRecords encodes the mails, the customer contacts are encrypted if
+// the keyring is set.
+func (c *KafkaConsumer) outboxRecords(
+	ctx context.Context, mails []domain.Mail,
+) ([]*kgo.Record, error) {
+	const op = "KafkaConsumer.outboxRecords"
+
+	recs := make([]*kgo.Record, 0, len(mails))
+	for _, mail := range mails {
+		evt := NewMailOutboxV1(mail)
+		headers := createHeaders(
+			ctx, mail.ReceiptUUID, contentTypeJSON, schemaVersionV1)
+		if c.keyring != nil {
+			encHeaders, err := evt.Encrypt(c.keyring)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			headers = append(headers, encHeaders...)
+		}
+
+		v, err := json.Marshal(evt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		recs = append(recs, &kgo.Record{
+			Topic:   c.outboxTopic,
+			Key:     []byte(mail.ReceiptUUID),
+			Value:   v,
+			Headers: headers,
+		})
+	}
+	return recs, nil
+}
+
+// endTransaction commits the produced records together with the consumed
+// offsets or aborts the transaction on error, so the records are consumed
+// again.
+func (c *KafkaConsumer) endTransaction(ctx context.Context, err error) {
+	const op = "KafkaConsumer.endTransaction"
 	log := c.log.WithOp(op)
 
-	if err := c.kcl.CommitUncommittedOffsets(ctx); err != nil {
-		log.Error().Err(err).Msg("failed to commit offsets")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to handle receipts")
+	}
+
+	committed, err := c.sess.End(ctx, kgo.TransactionEndTry(err == nil))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to end transaction")
+		return
+	}
+	if !committed {
+		log.Warn().Msg("transaction aborted")
+		return
 	}
 	log.Debug().Msg("successfuly committed")
 }
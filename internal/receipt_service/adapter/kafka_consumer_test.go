@@ -0,0 +1,129 @@
+//go:build !integration
+
+package adapter_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/config"
+	"github.com/niksmo/receipt/internal/receipt_service/adapter"
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const testEmail = "john.doe@example.com"
+
+func newTestKeyring(t *testing.T) *fieldcrypt.Keyring {
+	t.Helper()
+	kr, err := fieldcrypt.NewKeyring("k1", map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+	}, bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	return kr
+}
+
+// newIdleConsumer creates the consumer which is never run, so the broker is
+// not reached.
+func newIdleConsumer(
+	t *testing.T, keyring *fieldcrypt.Keyring,
+) *adapter.KafkaConsumer {
+	t.Helper()
+	c := adapter.NewKafkaConsumer(logger.New("disabled"), config.BrokerConfig{
+		SeedBrokers:     []string{"127.0.0.1:1"},
+		Topic:           "mail-receipt",
+		OutboxTopic:     "mail-outbox",
+		ConsumerGroup:   "mail-group",
+		TransactionalID: "receipt-test",
+	}, nil, nil, keyring)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func fetchRecords(t *testing.T, seedBrokers []string, topic string) []*kgo.Record {
+	t.Helper()
+	kcl, err := kgo.NewClient(
+		kgo.SeedBrokers(seedBrokers...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+	defer kcl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	fetches := kcl.PollFetches(ctx)
+	require.NoError(t, fetches.Err0())
+	return fetches.Records()
+}
+
+func TestKafkaConsumerDecrypt(t *testing.T) {
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(1, "mail-receipt"))
+	require.NoError(t, err)
+	defer c.Close()
+
+	keyring := newTestKeyring(t)
+	p := adapter.NewKafkaProducer(logger.New("disabled"), config.BrokerConfig{
+		SeedBrokers:        c.ListenAddrs(),
+		Topic:              "mail-receipt",
+		MaxBufferedRecords: 1,
+		KeyStrategy:        config.KeyStrategyCustomerEmail,
+		Codec:              config.CodecJSON,
+	}, adapter.NewMemoryStatusStore(), nil, keyring)
+	defer p.Close()
+
+	rct := domain.Receipt{UUID: "a", CustomerEmail: testEmail}
+	require.NoError(t, p.ProduceEvent(context.Background(), rct))
+
+	recs := fetchRecords(t, c.ListenAddrs(), "mail-receipt")
+	require.Len(t, recs, 1)
+	assert.NotContains(t, string(recs[0].Value), "john.doe")
+	assert.Equal(t, keyring.MAC(testEmail), string(recs[0].Key))
+
+	t.Run("decrypt", func(t *testing.T) {
+		rcts, err := newIdleConsumer(t, keyring).RetrieveReceipts(
+			context.Background(), recs)
+		require.NoError(t, err)
+		require.Len(t, rcts, 1)
+		assert.Equal(t, testEmail, rcts[0].CustomerEmail)
+	})
+
+	t.Run("no_keyring", func(t *testing.T) {
+		// the record is not skipped, so it is not lost
+		_, err := newIdleConsumer(t, nil).RetrieveReceipts(
+			context.Background(), recs)
+		assert.ErrorIs(t, err, fieldcrypt.ErrNoKeyring)
+	})
+}
+
+func TestKafkaConsumerOutboxEncrypt(t *testing.T) {
+	keyring := newTestKeyring(t)
+	mail := domain.Mail{
+		ReceiptUUID: "a",
+		To:          testEmail,
+		Subject:     "Receipt",
+		Text:        "Dear " + testEmail,
+		HTML:        "<p>Dear " + testEmail + "</p>",
+	}
+
+	recs, err := newIdleConsumer(t, keyring).OutboxRecords(
+		context.Background(), []domain.Mail{mail})
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.NotContains(t, string(recs[0].Value), "john.doe")
+
+	var evt outbox.MailV1
+	require.NoError(t, json.Unmarshal(recs[0].Value, &evt))
+	require.NoError(t, evt.Decrypt(keyring, recs[0]))
+	assert.Equal(t, adapter.NewMailOutboxV1(mail), evt)
+}
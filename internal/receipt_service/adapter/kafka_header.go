@@ -0,0 +1,90 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/niksmo/receipt/pkg/tracing"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	headerContentType   = "content-type"
+	headerSchemaVersion = "schema-version"
+	headerReceiptUUID   = "receipt-uuid"
+	headerProducedAt    = "produced-at"
+	headerSourceService = "source-service"
+	headerRequestID     = requestid.RecordHeader
+
+	encFieldCustomerEmail = "customer_email"
+
+	contentTypeJSON = "application/json"
+	schemaVersionV1 = "1"
+	sourceService   = "receipt_service"
+)
+
+type recordMeta struct {
+	ContentType   string
+	SchemaVersion string
+	ReceiptUUID   string
+	ProducedAt    time.Time
+	SourceService string
+	RequestID     string
+}
+
+// createHeaders returns the record headers including the trace context of
+// the context span and the request ID, if any.
+func createHeaders(
+	ctx context.Context, uuid string, contentType string, schemaVersion string,
+) []kgo.RecordHeader {
+	kr := kgo.Record{Headers: []kgo.RecordHeader{
+		{Key: headerContentType, Value: []byte(contentType)},
+		{Key: headerSchemaVersion, Value: []byte(schemaVersion)},
+		{Key: headerReceiptUUID, Value: []byte(uuid)},
+		{Key: headerProducedAt, Value: []byte(
+			time.Now().UTC().Format(time.RFC3339Nano))},
+		{Key: headerSourceService, Value: []byte(sourceService)},
+	}}
+	if id := requestid.FromContext(ctx); id != "" {
+		kr.Headers = append(
+			kr.Headers, kgo.RecordHeader{Key: headerRequestID, Value: []byte(id)})
+	}
+	tracing.Inject(ctx, tracing.RecordCarrier{Record: &kr})
+	return kr.Headers
+}
+
+// readMeta reads the record headers. Records without headers are treated as
+// JSON encoded with the first schema version.
+func readMeta(rec *kgo.Record) (recordMeta, error) {
+	const op = "readMeta"
+
+	meta := recordMeta{
+		ContentType:   contentTypeJSON,
+		SchemaVersion: schemaVersionV1,
+	}
+
+	for _, h := range rec.Headers {
+		v := string(h.Value)
+		switch h.Key {
+		case headerContentType:
+			meta.ContentType = v
+		case headerSchemaVersion:
+			meta.SchemaVersion = v
+		case headerReceiptUUID:
+			meta.ReceiptUUID = v
+		case headerProducedAt:
+			producedAt, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return recordMeta{}, fmt.Errorf("%s: %w", op, err)
+			}
+			meta.ProducedAt = producedAt
+		case headerSourceService:
+			meta.SourceService = v
+		case headerRequestID:
+			meta.RequestID = v
+		}
+	}
+	return meta, nil
+}
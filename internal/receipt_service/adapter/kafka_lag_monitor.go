@@ -0,0 +1,242 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/niksmo/receipt/internal/receipt_service/core/port"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var _ port.LagReporter = (*LagMonitor)(nil)
+
+const oldestRecordTimeout = 5 * time.Second
+
+// LagMonitorConfig sets the observed group and topic, how often the lag is
+// observed and the thresholds a warning is logged above.
+type LagMonitorConfig struct {
+	SeedBrokers  []string
+	Security     kafkaclient.Security
+	Group        string
+	Topic        string
+	Interval     time.Duration
+	LagThreshold int64
+	AgeThreshold time.Duration
+}
+
+// LagMonitor periodically observes the committed lag of the consumer group
+// and the age of the oldest record it has not processed yet.
+type LagMonitor struct {
+	log   logger.Logger
+	kcl   *kgo.Client
+	adm   *kadm.Client
+	group string
+	topic string
+	cfg   LagMonitorConfig
+
+	mu     sync.RWMutex
+	report *domain.LagReport
+}
+
+func NewLagMonitor(log logger.Logger, cfg LagMonitorConfig) *LagMonitor {
+	// The client consumes the lagging partitions directly, so the oldest
+	// records are read without joining the group.
+	opts, err := kafkaclient.Opts(cfg.SeedBrokers, cfg.Security)
+	if err != nil {
+		panic(err) // validated on config load
+	}
+
+	kcl, err := kgo.NewClient(append(opts,
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+	)...)
+	if err != nil {
+		panic(err) // developer mistake
+	}
+
+	return &LagMonitor{
+		log:   log,
+		kcl:   kcl,
+		adm:   kadm.NewClient(kcl),
+		group: cfg.Group,
+		topic: cfg.Topic,
+		cfg:   cfg,
+	}
+}
+
+func (m *LagMonitor) Run(ctx context.Context) {
+	const op = "LagMonitor.Run"
+	log := m.log.WithOp(op)
+
+	log.Info().Dur("interval", m.cfg.Interval).Msg("lag monitor is running")
+
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		m.observe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LagReport returns the last observed lag.
+func (m *LagMonitor) LagReport(context.Context) (domain.LagReport, error) {
+	const op = "LagMonitor.LagReport"
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.report == nil {
+		return domain.LagReport{}, fmt.Errorf(
+			"%s: %w", op, domain.ErrLagNotObserved)
+	}
+	return *m.report, nil
+}
+
+func (m *LagMonitor) Close() {
+	const op = "LagMonitor.Close"
+	log := m.log.WithOp(op)
+
+	log.Info().Msg("closing lag monitor")
+	m.kcl.Close()
+	log.Info().Msg("lag monitor is closed")
+}
+
+func (m *LagMonitor) observe(ctx context.Context) {
+	const op = "LagMonitor.observe"
+	log := m.log.WithOp(op)
+
+	report, err := m.lagReport(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to observe consumer lag")
+		}
+		return
+	}
+
+	for _, p := range report.Partitions {
+		metrics.SetGroupLag(m.group, m.topic, p.Partition, p.Lag)
+		if p.AgeUnknown {
+			// The last observed age is kept, the alert is not cleared by
+			// the failed read.
+			metrics.SetOldestRecordAgeUnknown(m.group, m.topic, p.Partition)
+			log.Warn().Str("group", m.group).Str("topic", m.topic).Int32(
+				"partition", p.Partition).Int64("lag", p.Lag).Msg(
+				"consumer is lagging, oldest record age is unknown")
+			continue
+		}
+		metrics.SetOldestRecordAge(m.group, m.topic, p.Partition, p.OldestAge)
+		if p.Lag > m.cfg.LagThreshold || p.OldestAge > m.cfg.AgeThreshold {
+			log.Warn().Str("group", m.group).Str("topic", m.topic).Int32(
+				"partition", p.Partition).Int64("lag", p.Lag).Dur(
+				"oldestAge", p.OldestAge).Msg("consumer is lagging")
+		}
+	}
+
+	m.mu.Lock()
+	m.report = &report
+	m.mu.Unlock()
+}
+
+func (m *LagMonitor) lagReport(ctx context.Context) (domain.LagReport, error) {
+	const op = "LagMonitor.lagReport"
+	log := m.log.WithOp(op)
+
+	lags, err := m.adm.Lag(ctx, m.group)
+	if err != nil {
+		return domain.LagReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+	groupLag := lags[m.group]
+	if err := groupLag.Error(); err != nil {
+		return domain.LagReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	report := domain.LagReport{Group: m.group, Topic: m.topic}
+	lagging := make(map[int32]kgo.Offset)
+	for _, l := range groupLag.Lag.Sorted() {
+		if l.Topic != m.topic {
+			continue
+		}
+		if l.Err != nil {
+			log.Warn().Err(l.Err).Int32(
+				"partition", l.Partition).Msg("partition lag is unknown")
+			continue
+		}
+
+		committed := l.Commit.At
+		if committed < 0 {
+			committed = l.Start.Offset
+		}
+		report.Partitions = append(report.Partitions, domain.PartitionLag{
+			Partition:       l.Partition,
+			CommittedOffset: committed,
+			EndOffset:       l.End.Offset,
+			Lag:             l.Lag,
+		})
+		if l.Lag > 0 {
+			lagging[l.Partition] = kgo.NewOffset().At(committed)
+		}
+	}
+
+	report.ObservedAt = time.Now()
+	ages := m.oldestAges(ctx, lagging, report.ObservedAt)
+	for i, p := range report.Partitions {
+		if p.Lag <= 0 {
+			continue
+		}
+		age, ok := ages[p.Partition]
+		report.Partitions[i].OldestAge = age
+		report.Partitions[i].AgeUnknown = !ok
+	}
+	return report, nil
+}
+
+// oldestAges reads the first unprocessed record of the lagging partitions.
+// The partitions the record is not read from in time are left out, their
+// age is unknown.
+func (m *LagMonitor) oldestAges(
+	ctx context.Context, offsets map[int32]kgo.Offset, now time.Time,
+) map[int32]time.Duration {
+	const op = "LagMonitor.oldestAges"
+	log := m.log.WithOp(op)
+
+	ages := make(map[int32]time.Duration, len(offsets))
+	if len(offsets) == 0 {
+		return ages
+	}
+
+	partitions := slices.Collect(maps.Keys(offsets))
+	m.kcl.AddConsumePartitions(
+		map[string]map[int32]kgo.Offset{m.topic: offsets})
+	defer m.kcl.RemoveConsumePartitions(
+		map[string][]int32{m.topic: partitions})
+
+	ctx, cancel := context.WithTimeout(ctx, oldestRecordTimeout)
+	defer cancel()
+	for len(ages) < len(partitions) {
+		fetches := m.kcl.PollFetches(ctx)
+		if ctx.Err() != nil || fetches.IsClientClosed() {
+			break
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			log.Warn().Err(err).Int32(
+				"partition", partition).Msg("failed to fetch oldest record")
+		})
+		fetches.EachRecord(func(rec *kgo.Record) {
+			if _, ok := ages[rec.Partition]; !ok {
+				ages[rec.Partition] = max(now.Sub(rec.Timestamp), 0)
+			}
+		})
+	}
+	return ages
+}
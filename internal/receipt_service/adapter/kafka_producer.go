@@ -2,16 +2,27 @@ package adapter
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/niksmo/receipt/config"
 	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
 	"github.com/niksmo/receipt/internal/receipt_service/core/port"
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
 	"github.com/niksmo/receipt/pkg/logger"
-	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/niksmo/receipt/pkg/schemaregistry"
+	"github.com/niksmo/receipt/pkg/tracing"
 	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ port.EventProducer = (*KafkaProducer)(nil)
@@ -22,26 +33,57 @@ const (
 )
 
 type KafkaProducer struct {
-	log   logger.Logger
-	kcl   *kgo.Client
-	topic string
+	log         logger.Logger
+	kcl         *kgo.Client
+	topic       string
+	async       bool
+	inflight    chan struct{}
+	keyStrategy config.KeyStrategy
+	codec       Codec
+	statuses    port.StatusStore
+	registry    schemaregistry.Registry
+	schemaID    atomic.Int64
+	keyring     *fieldcrypt.Keyring
 }
 
+// NewKafkaProducer creates the producer. The registry is optional, records
+// are framed in the schema registry wire format when it is set. The keyring
+// is optional too, the customer email is encrypted when it is set.
 func NewKafkaProducer(
-	log logger.Logger, seedBrokers []string, topic string,
+	log logger.Logger,
+	cfg config.BrokerConfig,
+	statuses port.StatusStore,
+	registry schemaregistry.Registry,
+	keyring *fieldcrypt.Keyring,
 ) *KafkaProducer {
-	kcl, err := kgo.NewClient(
-		kgo.SeedBrokers(seedBrokers...),
-		kgo.DefaultProduceTopic(topic),
+	opts, err := kafkaclient.Opts(cfg.SeedBrokers, cfg.Security)
+	if err != nil {
+		panic(err) // validated on config load
+	}
+
+	kcl, err := kgo.NewClient(append(opts,
+		kgo.DefaultProduceTopic(cfg.Topic),
 		kgo.RequiredAcks(kgo.AllISRAcks()),
 		kgo.RecordRetries(produceRetries),
 		kgo.ProducerBatchMaxBytes(maxBatchSize),
-	)
+		kgo.MaxBufferedRecords(cfg.MaxBufferedRecords),
+	)...)
 	if err != nil {
 		panic(err) // developer mistake
 	}
 
-	return &KafkaProducer{log, kcl, topic}
+	return &KafkaProducer{
+		log:         log,
+		kcl:         kcl,
+		topic:       cfg.Topic,
+		async:       cfg.AsyncProduce(),
+		inflight:    make(chan struct{}, cfg.MaxBufferedRecords),
+		keyStrategy: cfg.KeyStrategy,
+		codec:       NewCodec(cfg.Codec),
+		statuses:    statuses,
+		registry:    registry,
+		keyring:     keyring,
+	}
 }
 
 func (p *KafkaProducer) ProduceEvent(
@@ -49,18 +91,85 @@ func (p *KafkaProducer) ProduceEvent(
 ) error {
 	const op = "KafkaProducer.ProduceEvent"
 
-	kr, err := p.createRecord(rct)
+	ctx, span := p.startSpan(ctx)
+	kr, err := p.createRecord(ctx, rct)
 	if err != nil {
+		tracing.End(span, err)
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	if p.async {
+		if err := p.enqueue(ctx, &kr, rct.UUID, span); err != nil {
+			tracing.End(span, err)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	start := time.Now()
 	err = p.kcl.ProduceSync(ctx, &kr).FirstErr()
+	p.reportDelivery(ctx, rct.UUID, start, err)
+	tracing.End(span, err)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	return nil
 }
 
+func (p *KafkaProducer) ProduceEvents(
+	ctx context.Context, rcts []domain.Receipt,
+) []error {
+	const op = "KafkaProducer.ProduceEvents"
+
+	errs := make([]error, len(rcts))
+	var wg sync.WaitGroup
+	for i, rct := range rcts {
+		spanCtx, span := p.startSpan(ctx)
+		kr, err := p.createRecord(spanCtx, rct)
+		if err != nil {
+			tracing.End(span, err)
+			errs[i] = fmt.Errorf("%s: %w", op, err)
+			continue
+		}
+
+		if p.async {
+			if err := p.enqueue(spanCtx, &kr, rct.UUID, span); err != nil {
+				tracing.End(span, err)
+				errs[i] = fmt.Errorf("%s: %w", op, err)
+			}
+			continue
+		}
+
+		wg.Add(1)
+		start := time.Now()
+		p.kcl.Produce(spanCtx, &kr, func(_ *kgo.Record, err error) {
+			defer wg.Done()
+			p.reportDelivery(spanCtx, rct.UUID, start, err)
+			tracing.End(span, err)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", op, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// Shutdown waits until the buffered records are delivered or the context is
+// done, then closes the producer.
+func (p *KafkaProducer) Shutdown(ctx context.Context) {
+	const op = "KafkaProducer.Shutdown"
+	log := p.log.WithOp(op)
+
+	log.Info().Int64(
+		"nBuffered", p.kcl.BufferedProduceRecords()).Msg("flushing producer")
+	if err := p.kcl.Flush(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to flush producer")
+	}
+	p.Close()
+}
+
 func (p *KafkaProducer) Close() {
 	const op = "KafkaProducer.Close"
 	log := p.log.WithOp(op)
@@ -76,29 +185,215 @@ func (p *KafkaProducer) InitTopic(
 	const op = "KafkaProducer.InitTopic"
 	log := p.log.WithOp(op)
 
-	log.Info().Str("topic", p.topic).Msg("initializing topic...")
-	_, err := kadm.NewClient(p.kcl).CreateTopic(
-		ctx, int32(partitions), int16(repFactor), nil, p.topic,
-	)
+	err := kafkaclient.CreateTopic(ctx, log, p.kcl, p.topic, partitions, repFactor)
 	if err != nil {
-		if errors.Is(err, kerr.TopicAlreadyExists) {
-			log.Info().Str("topic", p.topic).Msg("topic already exists")
-			return
-		}
 		onFall(fmt.Errorf("%s: %w", op, err))
 		return
 	}
 
-	log.Info().Str("topic", p.topic).Msg("topic created")
+	if p.registry == nil {
+		return
+	}
+
+	id, err := p.registerSchema(ctx)
+	if err != nil {
+		onFall(fmt.Errorf("%s: %w", op, err))
+		return
+	}
+	log.Info().Int("schemaID", id).Msg("schema registered")
+}
+
+func (p *KafkaProducer) CheckBroker(ctx context.Context) error {
+	const op = "KafkaProducer.CheckBroker"
+
+	if err := kafkaclient.CheckBroker(ctx, p.kcl); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (p *KafkaProducer) CheckTopic(ctx context.Context) error {
+	const op = "KafkaProducer.CheckTopic"
+
+	if err := kafkaclient.CheckTopics(ctx, p.kcl, p.topic); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
 }
 
-func (p *KafkaProducer) createRecord(rct domain.Receipt) (kgo.Record, error) {
+// enqueue buffers the record without waiting for the broker acknowledgement.
+// The delivery result is reported to the status store by the promise.
+//
+// TryProduce reports a full buffer only through the promise, after the
+// caller is answered, so an in-flight slot is taken first and
+// kgo.ErrMaxBuffered is returned right away when there is none left.
+func (p *KafkaProducer) enqueue(
+	ctx context.Context, kr *kgo.Record, uuid string, span trace.Span,
+) error {
+	const op = "KafkaProducer.enqueue"
+
+	select {
+	case p.inflight <- struct{}{}:
+	default:
+		return fmt.Errorf("%s: %w", op, kgo.ErrMaxBuffered)
+	}
+
+	start := time.Now()
+	p.kcl.TryProduce(
+		context.WithoutCancel(ctx), kr,
+		func(_ *kgo.Record, err error) {
+			<-p.inflight
+			p.reportDelivery(ctx, uuid, start, err)
+			tracing.End(span, err)
+		},
+	)
+	return nil
+}
+
+// startSpan starts the producer span, its trace context is written to the
+// record headers.
+func (p *KafkaProducer) startSpan(
+	ctx context.Context,
+) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "publish "+p.topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", p.topic),
+		),
+	)
+}
+
+func (p *KafkaProducer) reportDelivery(
+	ctx context.Context, uuid string, start time.Time, err error,
+) {
+	const op = "KafkaProducer.reportDelivery"
+	log := p.log.Ctx(ctx).WithOp(op)
+
+	metrics.ObserveProduce(p.topic, start, err)
+	status := domain.NewReceiptStatus(uuid, domain.StatusProduced)
+	if err != nil {
+		status = domain.NewFailedStatus(uuid, failureReason(err))
+		log.Error().Err(err).Str("uuid", uuid).Str(
+			"reason", string(status.Reason)).Msg("failed to deliver receipt")
+	}
+	status.RequestID = requestid.FromContext(ctx)
+	p.statuses.SetStatus(context.WithoutCancel(ctx), status)
+}
+
+// failureReason maps the delivery error to the reason the clients see.
+func failureReason(err error) domain.FailureReason {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, kgo.ErrRecordTimeout):
+		return domain.ReasonTimeout
+	case errors.Is(err, kgo.ErrMaxBuffered):
+		return domain.ReasonOverloaded
+	case errors.Is(err, kerr.MessageTooLarge),
+		errors.Is(err, kerr.RecordListTooLarge):
+		return domain.ReasonTooLarge
+	default:
+		return domain.ReasonUnavailable
+	}
+}
+
+func (p *KafkaProducer) createRecord(
+	ctx context.Context, rct domain.Receipt,
+) (kgo.Record, error) {
 	const op = "KafkaProducer.createRecord"
 
-	v, err := json.Marshal(rct)
+	evt := NewReceiptRequestedV1(rct)
+	var env fieldcrypt.Envelope
+	if p.keyring != nil {
+		var err error
+		env, err = p.keyring.Encrypt(rct.UUID, &evt.CustomerEmail)
+		if err != nil {
+			return kgo.Record{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	v, err := p.codec.Encode(evt)
+	if err != nil {
+		return kgo.Record{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	v, err = p.frame(ctx, v)
 	if err != nil {
 		return kgo.Record{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return kgo.Record{Topic: p.topic, Value: v}, nil
+	kr := kgo.Record{
+		Topic: p.topic,
+		Key:   p.recordKey(rct),
+		Value: v,
+		Headers: createHeaders(
+			ctx, rct.UUID, p.codec.ContentType(), p.codec.SchemaVersion()),
+	}
+	if p.keyring != nil {
+		kr.Headers = append(
+			kr.Headers, fieldcrypt.RecordHeaders(env, encFieldCustomerEmail)...)
+	}
+	return kr, nil
+}
+
+// frame prepends the schema registry wire format header to the value.
+func (p *KafkaProducer) frame(ctx context.Context, v []byte) ([]byte, error) {
+	const op = "KafkaProducer.frame"
+
+	if p.registry == nil {
+		return v, nil
+	}
+
+	id, err := p.registerSchema(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	b := schemaregistry.AppendHeader(make([]byte, 0, len(v)+8), id)
+	if indexes := p.codec.MessageIndexes(); indexes != nil {
+		b = schemaregistry.AppendMessageIndexes(b, indexes...)
+	}
+	return append(b, v...), nil
+}
+
+// registerSchema registers the codec schema once and caches its ID.
+func (p *KafkaProducer) registerSchema(ctx context.Context) (int, error) {
+	const op = "KafkaProducer.registerSchema"
+
+	if id := p.schemaID.Load(); id != 0 {
+		return int(id), nil
+	}
+
+	id, err := p.registry.Register(
+		ctx, schemaregistry.TopicSubject(p.topic), p.codec.Schema())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	p.schemaID.Store(int64(id))
+	return id, nil
+}
+
+// recordKey returns nil for an empty key value, so such records are spread
+// by the partitioner instead of piling up in a single partition.
+func (p *KafkaProducer) recordKey(rct domain.Receipt) []byte {
+	var key string
+	switch p.keyStrategy {
+	case config.KeyStrategyINN:
+		key = rct.TaxpayerNumber
+	case config.KeyStrategyCustomerEmail:
+		key = strings.ToLower(rct.CustomerEmail)
+		if p.keyring != nil && key != "" {
+			// The encrypted email must not leak through the key.
+			key = p.keyring.MAC(key)
+		}
+	case config.KeyStrategyUUID:
+		key = rct.UUID
+	default:
+		key = rct.CashRegisterNumber
+	}
+
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
 }
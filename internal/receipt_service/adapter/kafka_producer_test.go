@@ -0,0 +1,143 @@
+//go:build !integration
+
+package adapter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/config"
+	"github.com/niksmo/receipt/internal/receipt_service/adapter"
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newAsyncProducer(
+	t *testing.T, seedBrokers []string, maxBuffered int,
+) (*adapter.KafkaProducer, *adapter.MemoryStatusStore) {
+	t.Helper()
+	statuses := adapter.NewMemoryStatusStore()
+	p := adapter.NewKafkaProducer(logger.New("disabled"), config.BrokerConfig{
+		SeedBrokers:        seedBrokers,
+		Topic:              "mail-receipt",
+		ProduceMode:        config.ProduceModeAsync,
+		MaxBufferedRecords: maxBuffered,
+		Codec:              config.CodecJSON,
+	}, statuses, nil, nil)
+	t.Cleanup(p.Close)
+	return p, statuses
+}
+
+func TestKafkaProducerAsync(t *testing.T) {
+	ctx := context.Background()
+	rct := domain.Receipt{UUID: "a", CashRegisterNumber: "1"}
+
+	t.Run("reports_delivery", func(t *testing.T) {
+		c, err := kfake.NewCluster(
+			kfake.NumBrokers(1), kfake.SeedTopics(1, "mail-receipt"))
+		require.NoError(t, err)
+		defer c.Close()
+
+		p, statuses := newAsyncProducer(t, c.ListenAddrs(), 10)
+		require.NoError(t, p.ProduceEvent(ctx, rct))
+
+		assert.Eventually(t, func() bool {
+			status, _ := statuses.Status(ctx, "a")
+			return status.Status == domain.StatusProduced
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("reports_failure", func(t *testing.T) {
+		// The topic does not exist, so the record fails after the enqueue
+		// returned.
+		c, err := kfake.NewCluster(kfake.NumBrokers(1))
+		require.NoError(t, err)
+		defer c.Close()
+
+		p, statuses := newAsyncProducer(t, c.ListenAddrs(), 10)
+		require.NoError(t, p.ProduceEvent(ctx, rct))
+
+		assert.Eventually(t, func() bool {
+			status, _ := statuses.Status(ctx, "a")
+			return status.Status == domain.StatusFailed &&
+				status.Reason == domain.ReasonUnavailable
+		}, 20*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("buffer_full", func(t *testing.T) {
+		// Nothing listens on the seed broker, so the first record stays
+		// buffered.
+		p, _ := newAsyncProducer(t, []string{"127.0.0.1:1"}, 1)
+		require.NoError(t, p.ProduceEvent(ctx, rct))
+
+		rct.UUID = "b"
+		err := p.ProduceEvent(ctx, rct)
+		assert.ErrorIs(t, err, kgo.ErrMaxBuffered)
+
+		errs := p.ProduceEvents(ctx, []domain.Receipt{rct})
+		assert.ErrorIs(t, errs[0], kgo.ErrMaxBuffered)
+	})
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := map[error]domain.FailureReason{
+		context.DeadlineExceeded:                      domain.ReasonTimeout,
+		kgo.ErrRecordTimeout:                          domain.ReasonTimeout,
+		fmt.Errorf("produce: %w", kgo.ErrMaxBuffered): domain.ReasonOverloaded,
+		kerr.MessageTooLarge:                          domain.ReasonTooLarge,
+		kerr.UnknownTopicOrPartition:                  domain.ReasonUnavailable,
+		errors.New("dial tcp: connection refused"):    domain.ReasonUnavailable,
+	}
+	for err, reason := range tests {
+		assert.Equal(t, reason, adapter.FailureReason(err), err.Error())
+	}
+}
+
+func TestRecordKey(t *testing.T) {
+	rct := domain.Receipt{
+		UUID:               "a",
+		CashRegisterNumber: "42",
+		TaxpayerNumber:     "7700000000",
+		CustomerEmail:      "John@Example.com",
+	}
+
+	tests := []struct {
+		name     string
+		strategy config.KeyStrategy
+		rct      domain.Receipt
+		want     []byte
+	}{
+		{"default", "", rct, []byte("42")},
+		{"cash_register", config.KeyStrategyCashRegister, rct, []byte("42")},
+		{"inn", config.KeyStrategyINN, rct, []byte("7700000000")},
+		{
+			"customer_email", config.KeyStrategyCustomerEmail, rct,
+			[]byte("john@example.com"),
+		},
+		{"uuid", config.KeyStrategyUUID, rct, []byte("a")},
+		{"empty_value", config.KeyStrategyINN, domain.Receipt{UUID: "a"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := adapter.NewKafkaProducer(
+				logger.New("disabled"),
+				config.BrokerConfig{
+					SeedBrokers:        []string{"127.0.0.1:1"},
+					MaxBufferedRecords: 1,
+					KeyStrategy:        tt.strategy,
+				},
+				adapter.NewMemoryStatusStore(), nil, nil,
+			)
+			defer p.Close()
+			assert.Equal(t, tt.want, p.RecordKey(tt.rct))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package adapter
+
+import (
+	"time"
+
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/niksmo/receipt/pkg/outbox"
+)
+
+// ProductV1 and ReceiptRequestedV1 define the wire contract of the receipt
+// topic. The JSON names match the payloads produced before the contract was
+// introduced and must not be changed: add a new event version instead.
+type ProductV1 struct {
+	Name       string `json:"Name"`
+	Quantity   int    `json:"Quantity"`
+	UnitPrice  int    `json:"UnitPrice"`
+	TotalPrice int    `json:"TotalPrice"`
+	TaxRate    string `json:"TaxRate"`
+	TaxValue   int    `json:"TaxValue"`
+}
+
+type ReceiptRequestedV1 struct {
+	UUID               string      `json:"UUID"`
+	Number             int         `json:"Number"`
+	Date               time.Time   `json:"Date"`
+	Organization       string      `json:"Organization"`
+	PaymentAddress     string      `json:"PaymentAddress"`
+	TaxpayerNumber     string      `json:"TaxpayerNumber"`
+	TaxationType       string      `json:"TaxationType"`
+	CalculationSign    string      `json:"CalculationSign"`
+	CustomerEmail      string      `json:"CustomerEmail"`
+	FiscalDeviceNumber string      `json:"FiscalDeviceNumber"`
+	CashRegisterNumber string      `json:"CashRegisterNumber"`
+	FiscalDocument     string      `json:"FiscalDocument"`
+	FiscalAttribute    string      `json:"FiscalAttribute"`
+	Products           []ProductV1 `json:"Products"`
+}
+
+func NewReceiptRequestedV1(r domain.Receipt) ReceiptRequestedV1 {
+	e := ReceiptRequestedV1{
+		UUID:               r.UUID,
+		Number:             r.Number,
+		Date:               r.Date,
+		Organization:       r.Organization,
+		PaymentAddress:     r.PaymentAddress,
+		TaxpayerNumber:     r.TaxpayerNumber,
+		TaxationType:       r.TaxationType,
+		CalculationSign:    r.CalculationSign,
+		CustomerEmail:      r.CustomerEmail,
+		FiscalDeviceNumber: r.FiscalDeviceNumber,
+		CashRegisterNumber: r.CashRegisterNumber,
+		FiscalDocument:     r.FiscalDocument,
+		FiscalAttribute:    r.FiscalAttribute,
+	}
+
+	for _, p := range r.Products {
+		e.Products = append(e.Products, ProductV1{
+			Name:       p.Name,
+			Quantity:   p.Quantity,
+			UnitPrice:  p.UnitPrice,
+			TotalPrice: p.TotalPrice,
+			TaxRate:    p.TaxRate,
+			TaxValue:   p.TaxValue,
+		})
+	}
+	return e
+}
+
+func (e ReceiptRequestedV1) ToDomain() domain.Receipt {
+	r := domain.Receipt{
+		UUID:               e.UUID,
+		Number:             e.Number,
+		Date:               e.Date,
+		Organization:       e.Organization,
+		PaymentAddress:     e.PaymentAddress,
+		TaxpayerNumber:     e.TaxpayerNumber,
+		TaxationType:       e.TaxationType,
+		CalculationSign:    e.CalculationSign,
+		CustomerEmail:      e.CustomerEmail,
+		FiscalDeviceNumber: e.FiscalDeviceNumber,
+		CashRegisterNumber: e.CashRegisterNumber,
+		FiscalDocument:     e.FiscalDocument,
+		FiscalAttribute:    e.FiscalAttribute,
+	}
+
+	for _, p := range e.Products {
+		r.Products = append(r.Products, domain.Product{
+			Name:       p.Name,
+			Quantity:   p.Quantity,
+			UnitPrice:  p.UnitPrice,
+			TotalPrice: p.TotalPrice,
+			TaxRate:    p.TaxRate,
+			TaxValue:   p.TaxValue,
+		})
+	}
+	return r
+}
+
+func NewMailOutboxV1(m domain.Mail) outbox.MailV1 {
+	return outbox.MailV1{
+		ReceiptUUID: m.ReceiptUUID,
+		To:          m.To,
+		Subject:     m.Subject,
+		Text:        m.Text,
+		HTML:        m.HTML,
+	}
+}
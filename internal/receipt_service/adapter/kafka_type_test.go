@@ -0,0 +1,78 @@
+//go:build !integration
+
+package adapter_test
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/internal/receipt_service/adapter"
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func testReceipt() domain.Receipt {
+	return domain.Receipt{
+		UUID:               "1f0e4c3a-9a4b-4a8e-8f5c-3c2d1b0a9f8e",
+		Number:             1234,
+		Date:               time.Date(2025, 7, 25, 14, 40, 0, 0, time.UTC),
+		Organization:       "ООО Ромашка",
+		PaymentAddress:     "г. Москва, ул. Правды, д. 1",
+		TaxpayerNumber:     "7745123451234",
+		TaxationType:       "ОСН",
+		CalculationSign:    "приход",
+		CustomerEmail:      "Happy_Customer@mail.ru",
+		FiscalDeviceNumber: "7380440801479592",
+		CashRegisterNumber: "0007768750034436",
+		FiscalDocument:     "16415",
+		FiscalAttribute:    "1805600812",
+		Products: []domain.Product{
+			{
+				Name:       "тапочки синие размер 42",
+				Quantity:   1,
+				UnitPrice:  23000,
+				TotalPrice: 23000,
+			},
+			{
+				Name:       "мыло душистое",
+				Quantity:   5,
+				UnitPrice:  8000,
+				TotalPrice: 40000,
+				TaxRate:    "20",
+				TaxValue:   8000,
+			},
+		},
+	}
+}
+
+func TestReceiptRequestedV1WireFormat(t *testing.T) {
+	golden := filepath.Join("testdata", "receipt_requested_v1.golden.json")
+
+	actual, err := json.MarshalIndent(
+		adapter.NewReceiptRequestedV1(testReceipt()), "", "  ")
+	require.NoError(t, err)
+
+	if *update {
+		require.NoError(t, os.WriteFile(golden, append(actual, '\n'), 0o644))
+	}
+
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+
+	t.Run("encode", func(t *testing.T) {
+		assert.JSONEq(t, string(expected), string(actual))
+	})
+
+	t.Run("decode", func(t *testing.T) {
+		var evt adapter.ReceiptRequestedV1
+		require.NoError(t, json.Unmarshal(expected, &evt))
+		assert.Equal(t, testReceipt(), evt.ToDomain())
+	})
+}
@@ -0,0 +1,17 @@
+package adapter
+
+import (
+	"time"
+
+	"github.com/niksmo/receipt/internal/receipt_service/core/port"
+	"github.com/niksmo/receipt/pkg/metrics"
+)
+
+var _ port.Metrics = PromMetrics{}
+
+// PromMetrics records the service metrics to the Prometheus registry.
+type PromMetrics struct{}
+
+func (PromMetrics) ObserveRender(format string, d time.Duration) {
+	metrics.ObserveRender(format, d)
+}
@@ -0,0 +1,64 @@
+package adapter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/niksmo/receipt/internal/receipt_service/core/port"
+)
+
+var _ port.StatusStore = (*MemoryStatusStore)(nil)
+
+const statusStoreCapacity = 100_000
+
+// MemoryStatusStore keeps the latest statuses of receipts in memory. When the
+// capacity is reached the oldest receipts are evicted.
+type MemoryStatusStore struct {
+	mu       sync.RWMutex
+	statuses map[string]domain.ReceiptStatus
+	order    []string
+	capacity int
+}
+
+func NewMemoryStatusStore() *MemoryStatusStore {
+	return &MemoryStatusStore{
+		statuses: make(map[string]domain.ReceiptStatus),
+		capacity: statusStoreCapacity,
+	}
+}
+
+func (s *MemoryStatusStore) SetStatus(
+	_ context.Context, status domain.ReceiptStatus,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.statuses[status.UUID]; !ok {
+		s.evict()
+		s.order = append(s.order, status.UUID)
+	}
+	s.statuses[status.UUID] = status
+}
+
+func (s *MemoryStatusStore) Status(
+	_ context.Context, uuid string,
+) (domain.ReceiptStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status, ok := s.statuses[uuid]
+	if !ok {
+		return domain.ReceiptStatus{}, domain.ErrStatusNotFound
+	}
+	return status, nil
+}
+
+func (s *MemoryStatusStore) evict() {
+	if len(s.order) < s.capacity {
+		return
+	}
+	oldest := s.order[0]
+	s.order = s.order[1:]
+	delete(s.statuses, oldest)
+}
@@ -0,0 +1,50 @@
+//go:build !integration
+
+package adapter_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/niksmo/receipt/internal/receipt_service/adapter"
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStatusStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("latest_status", func(t *testing.T) {
+		s := adapter.NewMemoryStatusStore()
+		s.SetStatus(ctx, domain.NewReceiptStatus("a", domain.StatusAccepted))
+		s.SetStatus(ctx, domain.NewReceiptStatus("a", domain.StatusProduced))
+
+		status, err := s.Status(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, domain.StatusProduced, status.Status)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		s := adapter.NewMemoryStatusStore()
+		_, err := s.Status(ctx, "a")
+		assert.ErrorIs(t, err, domain.ErrStatusNotFound)
+	})
+
+	t.Run("evicts_oldest", func(t *testing.T) {
+		const capacity = 100_000
+		s := adapter.NewMemoryStatusStore()
+		for i := range capacity + 1 {
+			s.SetStatus(ctx, domain.NewReceiptStatus(
+				fmt.Sprint(i), domain.StatusAccepted))
+		}
+
+		_, err := s.Status(ctx, "0")
+		assert.ErrorIs(t, err, domain.ErrStatusNotFound)
+		_, err = s.Status(ctx, "1")
+		assert.NoError(t, err)
+		_, err = s.Status(ctx, fmt.Sprint(capacity))
+		assert.NoError(t, err)
+	})
+}
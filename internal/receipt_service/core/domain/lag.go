@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLagNotObserved = errors.New("consumer lag is not observed yet")
+
+// PartitionLag is the progress of the consumer group on a topic partition.
+type PartitionLag struct {
+	Partition       int32
+	CommittedOffset int64
+	EndOffset       int64
+	Lag             int64
+	// OldestAge is the age of the oldest unprocessed record, zero if the
+	// partition is not lagging.
+	OldestAge time.Duration
+	// AgeUnknown is set if the oldest record of the lagging partition is not
+	// read in time, OldestAge is zero then.
+	AgeUnknown bool
+}
+
+type LagReport struct {
+	Group      string
+	Topic      string
+	Partitions []PartitionLag
+	ObservedAt time.Time
+}
+
+func (r LagReport) TotalLag() int64 {
+	var total int64
+	for _, p := range r.Partitions {
+		total += max(p.Lag, 0)
+	}
+	return total
+}
+
+// MaxAge returns the oldest known age, the partitions with the unknown age
+// are skipped.
+func (r LagReport) MaxAge() time.Duration {
+	var age time.Duration
+	for _, p := range r.Partitions {
+		age = max(age, p.OldestAge)
+	}
+	return age
+}
@@ -0,0 +1,10 @@
+package domain
+
+// Mail is a rendered receipt ready to be sent to the customer.
+type Mail struct {
+	ReceiptUUID string
+	To          string
+	Subject     string
+	Text        string
+	HTML        string
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrStatusNotFound = errors.New("receipt status not found")
+
+type Status string
+
+const (
+	StatusAccepted Status = "accepted"
+	StatusProduced Status = "produced"
+	StatusFailed   Status = "failed"
+)
+
+// FailureReason is the public code of a failed delivery. The error details
+// are logged by the service only.
+type FailureReason string
+
+const (
+	ReasonTimeout     FailureReason = "timeout"
+	ReasonOverloaded  FailureReason = "overloaded"
+	ReasonTooLarge    FailureReason = "too_large"
+	ReasonUnavailable FailureReason = "unavailable"
+)
+
+type ReceiptStatus struct {
+	UUID      string
+	Status    Status
+	Reason    FailureReason
+	RequestID string
+	UpdatedAt time.Time
+}
+
+func NewReceiptStatus(uuid string, status Status) ReceiptStatus {
+	return ReceiptStatus{UUID: uuid, Status: status, UpdatedAt: time.Now()}
+}
+
+func NewFailedStatus(uuid string, reason FailureReason) ReceiptStatus {
+	s := NewReceiptStatus(uuid, StatusFailed)
+	s.Reason = reason
+	return s
+}
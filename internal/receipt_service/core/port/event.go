@@ -8,12 +8,14 @@ import (
 
 type EventSaver interface {
 	SaveEvent(context.Context, domain.Receipt) error
+	SaveEvents(context.Context, []domain.Receipt) []error
 }
 
 type EventProducer interface {
 	ProduceEvent(context.Context, domain.Receipt) error
+	ProduceEvents(context.Context, []domain.Receipt) []error
 }
 
 type EventProcessor interface {
-	ProcessEvent(context.Context, []domain.Receipt)
+	ProcessEvent(context.Context, []domain.Receipt) []domain.Mail
 }
@@ -0,0 +1,12 @@
+package port
+
+import (
+	"context"
+
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+)
+
+// LagReporter reports the consumer group lag observed last.
+type LagReporter interface {
+	LagReport(context.Context) (domain.LagReport, error)
+}
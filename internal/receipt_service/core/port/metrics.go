@@ -0,0 +1,8 @@
+package port
+
+import "time"
+
+// Metrics records the service metrics.
+type Metrics interface {
+	ObserveRender(format string, d time.Duration)
+}
@@ -0,0 +1,16 @@
+package port
+
+import (
+	"context"
+
+	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
+)
+
+type StatusStore interface {
+	SetStatus(context.Context, domain.ReceiptStatus)
+	Status(ctx context.Context, uuid string) (domain.ReceiptStatus, error)
+}
+
+type StatusProvider interface {
+	ReceiptStatus(ctx context.Context, uuid string) (domain.ReceiptStatus, error)
+}
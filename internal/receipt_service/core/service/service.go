@@ -8,24 +8,51 @@ import (
 	"github.com/niksmo/receipt/internal/receipt_service/core/domain"
 	"github.com/niksmo/receipt/internal/receipt_service/core/port"
 	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/niksmo/receipt/pkg/tracing"
 )
 
-const produceTimeout = 3 * time.Second
-
 var _ port.EventSaver = (*Service)(nil)
 var _ port.EventProcessor = (*Service)(nil)
+var _ port.StatusProvider = (*Service)(nil)
 
 type Service struct {
-	log  logger.Logger
-	evtP port.EventProducer
+	log      logger.Logger
+	evtP     port.EventProducer
+	statuses port.StatusStore
+	metrics  port.Metrics
+	tmpl     TextTemplateEngine
+	htmlTmpl HTMLTemplateEngine
+
+	produceTimeout      time.Duration
+	batchProduceTimeout time.Duration
 }
 
-func NewService(log logger.Logger, evtP port.EventProducer) *Service {
-	return &Service{log, evtP}
+func NewService(
+	log logger.Logger,
+	evtP port.EventProducer,
+	statuses port.StatusStore,
+	metrics port.Metrics,
+	produceTimeout, batchProduceTimeout time.Duration,
+) *Service {
+	return &Service{
+		log:                 log,
+		evtP:                evtP,
+		statuses:            statuses,
+		metrics:             metrics,
+		tmpl:                NewReceiptTemplateEngine(),
+		htmlTmpl:            NewReceiptHTMLTemplateEngine(),
+		produceTimeout:      produceTimeout,
+		batchProduceTimeout: batchProduceTimeout,
+	}
 }
 
 func (s *Service) SaveEvent(ctx context.Context, rct domain.Receipt) error {
 	const op = "Service.SaveEvent"
+	s.accept(ctx, rct)
+
+	ctx, cancel := context.WithTimeout(ctx, s.produceTimeout)
+	defer cancel()
 	err := s.evtP.ProduceEvent(ctx, rct)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -33,8 +60,75 @@ func (s *Service) SaveEvent(ctx context.Context, rct domain.Receipt) error {
 	return nil
 }
 
-func (s *Service) ProcessEvent(ctx context.Context, rcts []domain.Receipt) {
+func (s *Service) SaveEvents(
+	ctx context.Context, rcts []domain.Receipt,
+) []error {
+	const op = "Service.SaveEvents"
+	for _, rct := range rcts {
+		s.accept(ctx, rct)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.batchProduceTimeout)
+	defer cancel()
+	errs := s.evtP.ProduceEvents(ctx, rcts)
+	for i, err := range errs {
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return errs
+}
+
+func (s *Service) ReceiptStatus(
+	ctx context.Context, uuid string,
+) (domain.ReceiptStatus, error) {
+	const op = "Service.ReceiptStatus"
+	status, err := s.statuses.Status(ctx, uuid)
+	if err != nil {
+		return domain.ReceiptStatus{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return status, nil
+}
+
+func (s *Service) accept(ctx context.Context, rct domain.Receipt) {
+	status := domain.NewReceiptStatus(rct.UUID, domain.StatusAccepted)
+	status.RequestID = requestid.FromContext(ctx)
+	s.statuses.SetStatus(ctx, status)
+}
+
+func (s *Service) ProcessEvent(
+	ctx context.Context, rcts []domain.Receipt,
+) []domain.Mail {
 	const op = "Service.ProcessEvent"
 	log := s.log.WithOp(op)
-	log.Debug().Msg("processed")
+
+	mails := make([]domain.Mail, 0, len(rcts))
+	for i := range rcts {
+		mails = append(mails, s.renderMail(ctx, &rcts[i]))
+	}
+	log.Debug().Int("nMails", len(mails)).Msg("processed")
+	return mails
+}
+
+func (s *Service) renderMail(
+	ctx context.Context, rct *domain.Receipt,
+) domain.Mail {
+	_, span := tracing.Start(ctx, "render receipt")
+	defer span.End()
+
+	start := time.Now()
+	text := s.tmpl.ToText(rct)
+	s.metrics.ObserveRender("text", time.Since(start))
+
+	start = time.Now()
+	html := s.htmlTmpl.ToHTML(rct)
+	s.metrics.ObserveRender("html", time.Since(start))
+
+	return domain.Mail{
+		ReceiptUUID: rct.UUID,
+		To:          rct.CustomerEmail,
+		Subject:     fmt.Sprintf("Кассовый чек № %d", rct.Number),
+		Text:        text,
+		HTML:        html,
+	}
 }
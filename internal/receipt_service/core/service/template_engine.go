@@ -15,19 +15,15 @@ const DateLayout = "01.02.06 15:04"
 //go:embed text.template
 var receiptTemplate string
 
+//go:embed html.template
+var receiptHTMLTemplate string
+
 type TextTemplateEngine struct {
 	template *template.Template
 }
 
 func NewReceiptTemplateEngine() TextTemplateEngine {
-	funcMap := template.FuncMap{
-		"formatDate": formatDate,
-		"upper":      strings.ToUpper,
-		"lower":      strings.ToLower,
-		"cost":       cost,
-	}
-
-	t, err := template.New("receipt").Funcs(funcMap).Parse(receiptTemplate)
+	t, err := template.New("receipt").Funcs(funcMap()).Parse(receiptTemplate)
 	if err != nil {
 		panic(err)
 	}
@@ -41,6 +37,35 @@ func (t TextTemplateEngine) ToText(r *domain.Receipt) string {
 	return b.String()
 }
 
+type HTMLTemplateEngine struct {
+	template *template.Template
+}
+
+func NewReceiptHTMLTemplateEngine() HTMLTemplateEngine {
+	t, err := template.New("receiptHTML").Funcs(funcMap()).Parse(
+		receiptHTMLTemplate)
+	if err != nil {
+		panic(err)
+	}
+
+	return HTMLTemplateEngine{t}
+}
+
+func (t HTMLTemplateEngine) ToHTML(r *domain.Receipt) string {
+	var b bytes.Buffer
+	t.template.Execute(&b, r)
+	return b.String()
+}
+
+func funcMap() template.FuncMap {
+	return template.FuncMap{
+		"formatDate": formatDate,
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"cost":       cost,
+	}
+}
+
 func formatDate(d time.Time) string {
 	return d.Format(DateLayout)
 }
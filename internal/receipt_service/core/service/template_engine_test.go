@@ -13,6 +13,32 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func TestHTMLRenderer(t *testing.T) {
+	receipt := domain.Receipt{
+		Number:        1234,
+		Organization:  "ООО <Ромашка>",
+		CustomerEmail: "Happy_Customer@mail.ru",
+		Products: []domain.Product{
+			{
+				Name:       "мыло душистое",
+				Quantity:   5,
+				UnitPrice:  8000,
+				TotalPrice: 40000,
+				TaxRate:    "20",
+				TaxValue:   8000,
+			},
+		},
+	}
+
+	templateEngine := service.NewReceiptHTMLTemplateEngine()
+	actual := templateEngine.ToHTML(&receipt)
+	assert.Contains(t, actual, "Кассовый чек № 1234")
+	assert.Contains(t, actual, "ООО &lt;Ромашка&gt;")
+	assert.Contains(t, actual, "5 x 80.00</td><td>=400.00")
+	assert.Contains(t, actual, "в т.ч. НДС 20</td><td>=80.00")
+	assert.Contains(t, actual, "happy_customer@mail.ru")
+}
+
 func TestRenderer(t *testing.T) {
 	date, err := time.Parse(service.DateLayout, "07.25.25 14:40")
 	require.NoError(t, err)
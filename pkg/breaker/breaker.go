@@ -0,0 +1,125 @@
+// Package breaker implements a circuit breaker with half-open probing.
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker opens after the given number of consecutive failures. Once the
+// open timeout elapses it lets a single probe call through: the breaker is
+// closed if the probe succeeds and opened again otherwise.
+type Breaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	state       State
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// New returns the breaker. It panics if the threshold is not positive.
+func New(threshold int, openTimeout time.Duration) *Breaker {
+	if threshold <= 0 {
+		panic(fmt.Sprintf("breaker: invalid threshold %d", threshold))
+	}
+	return &Breaker{threshold: threshold, openTimeout: openTimeout}
+}
+
+// Call is the call allowed by the breaker, it must be finished by Done or
+// Cancel.
+type Call struct {
+	b     *Breaker
+	probe bool
+}
+
+// Allow reports whether the call may proceed. Otherwise it returns the time
+// left until the next probe.
+func (b *Breaker) Allow() (Call, time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		left := b.openTimeout - time.Since(b.openedAt)
+		if left > 0 {
+			return Call{}, left, false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return Call{b: b, probe: true}, 0, true
+	case StateHalfOpen:
+		if b.probing {
+			return Call{}, b.openTimeout, false
+		}
+		b.probing = true
+		return Call{b: b, probe: true}, 0, true
+	default:
+		return Call{b: b}, 0, true
+	}
+}
+
+// Done records the result of the call. The results of the calls allowed
+// before the breaker opened are ignored until it is closed again.
+func (c Call) Done(success bool) {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !c.probe && b.state != StateClosed {
+		return
+	}
+
+	if success {
+		b.state = StateClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if c.probe || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+// Cancel finishes the call without recording its result, e.g. when the call
+// is interrupted by the caller. The canceled probe lets the next call probe.
+func (c Call) Cancel() {
+	if !c.probe {
+		return
+	}
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,96 @@
+//go:build !integration
+
+package breaker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/pkg/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	const openTimeout = 50 * time.Millisecond
+	b := breaker.New(2, openTimeout)
+
+	for range 2 {
+		call, _, ok := b.Allow()
+		require.True(t, ok)
+		call.Done(false)
+	}
+	assert.Equal(t, breaker.StateOpen, b.State())
+
+	_, left, ok := b.Allow()
+	assert.False(t, ok)
+	assert.Positive(t, left)
+
+	time.Sleep(openTimeout)
+
+	probe, _, ok := b.Allow()
+	require.True(t, ok, "probe must be allowed")
+	assert.Equal(t, breaker.StateHalfOpen, b.State())
+	_, _, ok = b.Allow()
+	assert.False(t, ok, "only one probe at a time")
+
+	probe.Done(false)
+	assert.Equal(t, breaker.StateOpen, b.State())
+
+	time.Sleep(openTimeout)
+
+	probe, _, ok = b.Allow()
+	require.True(t, ok)
+	probe.Done(true)
+	assert.Equal(t, breaker.StateClosed, b.State())
+}
+
+func TestBreakerCancel(t *testing.T) {
+	const openTimeout = 50 * time.Millisecond
+
+	t.Run("non_probe_keeps_probe", func(t *testing.T) {
+		b := breaker.New(1, openTimeout)
+		stale, _, ok := b.Allow()
+		require.True(t, ok)
+		call, _, ok := b.Allow()
+		require.True(t, ok)
+		call.Done(false)
+		require.Equal(t, breaker.StateOpen, b.State())
+
+		time.Sleep(openTimeout)
+		probe, _, ok := b.Allow()
+		require.True(t, ok)
+
+		stale.Cancel()
+		_, _, ok = b.Allow()
+		assert.False(t, ok, "only one probe at a time")
+
+		stale.Done(true)
+		assert.Equal(t, breaker.StateHalfOpen, b.State(),
+			"stale result must be ignored")
+
+		probe.Done(true)
+		assert.Equal(t, breaker.StateClosed, b.State())
+	})
+
+	t.Run("probe_lets_next_probe", func(t *testing.T) {
+		b := breaker.New(1, openTimeout)
+		call, _, _ := b.Allow()
+		call.Done(false)
+
+		time.Sleep(openTimeout)
+		probe, _, ok := b.Allow()
+		require.True(t, ok)
+		probe.Cancel()
+
+		_, _, ok = b.Allow()
+		assert.True(t, ok)
+		assert.Equal(t, breaker.StateHalfOpen, b.State())
+	})
+}
+
+func TestBreakerInvalidThreshold(t *testing.T) {
+	for _, threshold := range []int{0, -1} {
+		assert.Panics(t, func() { breaker.New(threshold, time.Second) })
+	}
+}
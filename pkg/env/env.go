@@ -3,7 +3,6 @@ package env
 import (
 	"errors"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 )
@@ -13,54 +12,61 @@ var ErrNotSet = errors.New("the env variable is not specified")
 func String(
 	name string, validationFunc func(v string) error,
 ) (string, error) {
-	v, set := os.LookupEnv(name)
-	if !set {
-		return "", ErrNotSet
-	}
-	if validationFunc != nil {
-		if err := validationFunc(v); err != nil {
-			return "", err
-		}
-	}
-
-	return v, nil
+	return parse(name, "string",
+		func(v string) (string, error) { return v, nil }, validationFunc)
 }
 
 func Int(name string, validationFunc func(v int) error) (int, error) {
-	vStr, set := os.LookupEnv(name)
-	if !set {
-		return 0, ErrNotSet
-	}
+	return parse(name, "int", strconv.Atoi, validationFunc)
+}
 
-	v, err := strconv.Atoi(vStr)
-	if err != nil {
-		return 0, fmt.Errorf("env %s invalid 'int' value: %w", name, err)
-	}
+func StringS(
+	name string, validationFunc func(v []string) error,
+) ([]string, error) {
+	return parse(name, "[]string",
+		func(v string) ([]string, error) {
+			return strings.Split(v, ","), nil
+		},
+		validationFunc,
+	)
+}
 
-	if validationFunc != nil {
-		if err := validationFunc(v); err != nil {
-			return 0, err
+// Optional returns the default value if the variable is not set. The loaders
+// are required otherwise:
+//
+//	timeout, err := env.Optional(env.Duration("TIMEOUT", nil))(5 * time.Second)
+func Optional[T any](v T, err error) func(defaultValue T) (T, error) {
+	return func(defaultValue T) (T, error) {
+		if errors.Is(err, ErrNotSet) {
+			return defaultValue, nil
 		}
+		return v, err
 	}
-
-	return v, nil
 }
 
-func StringS(
-	name string, validationFunc func(v []string) error,
-) ([]string, error) {
-	v, set := os.LookupEnv(name)
+func parse[T any](
+	name string,
+	typeName string,
+	parseFunc func(v string) (T, error),
+	validationFunc func(v T) error,
+) (T, error) {
+	var zero T
+
+	s, set := lookup(name)
 	if !set {
-		return nil, ErrNotSet
+		return zero, ErrNotSet
 	}
 
-	s := strings.Split(v, ",")
+	v, err := parseFunc(s)
+	if err != nil {
+		return zero, fmt.Errorf("env %s invalid '%s' value: %w", name, typeName, err)
+	}
 
 	if validationFunc != nil {
-		if err := validationFunc(s); err != nil {
-			return nil, err
+		if err := validationFunc(v); err != nil {
+			return zero, err
 		}
 	}
 
-	return s, nil
+	return v, nil
 }
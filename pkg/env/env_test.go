@@ -0,0 +1,84 @@
+//go:build !integration
+
+package env_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/pkg/env"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := map[string]env.Bytes{
+		"512":    512,
+		"200KiB": 200 << 10,
+		"1.5MB":  1_500_000,
+		"2 GiB":  2 << 30,
+	}
+	for s, want := range tests {
+		got, err := env.ParseBytes(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+
+	_, err := env.ParseBytes("10XB")
+	assert.Error(t, err)
+}
+
+func TestOptional(t *testing.T) {
+	d, err := env.Optional(env.Duration("TEST_TIMEOUT", nil))(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, d)
+
+	t.Setenv("TEST_TIMEOUT", "forever")
+	_, err = env.Optional(env.Duration("TEST_TIMEOUT", nil))(time.Second)
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	type server struct {
+		Timeout  time.Duration `env:"TEST_TIMEOUT" default:"5s" min:"1ms"`
+		MaxBytes env.Bytes     `env:"TEST_MAX_BYTES" default:"1MiB"`
+	}
+	type config struct {
+		Mode    string            `env:"TEST_MODE" default:"sync" enum:"sync,async"`
+		Brokers []string          `env:"TEST_BROKERS" required:"true"`
+		Labels  map[string]string `env:"TEST_LABELS"`
+		Ratio   float64           `env:"TEST_RATIO" default:"0.5"`
+		Server  server
+	}
+
+	t.Run("values", func(t *testing.T) {
+		t.Setenv("TEST_BROKERS", "a:9092,b:9092")
+		t.Setenv("TEST_LABELS", "env=prod, zone=a")
+		t.Setenv("TEST_MAX_BYTES", "200KiB")
+
+		var cfg config
+		require.NoError(t, env.Load(&cfg))
+		assert.Equal(t, config{
+			Mode:    "sync",
+			Brokers: []string{"a:9092", "b:9092"},
+			Labels:  map[string]string{"env": "prod", "zone": "a"},
+			Ratio:   0.5,
+			Server:  server{Timeout: 5 * time.Second, MaxBytes: 200 << 10},
+		}, cfg)
+	})
+
+	t.Run("all_errors", func(t *testing.T) {
+		t.Setenv("TEST_MODE", "fire")
+		t.Setenv("TEST_RATIO", "half")
+		t.Setenv("TEST_TIMEOUT", "0s")
+
+		var cfg config
+		err := env.Load(&cfg)
+		require.Error(t, err)
+		for _, name := range []string{
+			"TEST_MODE", "TEST_BROKERS", "TEST_RATIO", "TEST_TIMEOUT",
+		} {
+			assert.ErrorContains(t, err, name)
+		}
+	})
+}
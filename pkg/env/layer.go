@@ -0,0 +1,70 @@
+package env
+
+import (
+	"os"
+	"slices"
+	"sync"
+)
+
+// Layer is a configuration source the variables are looked up in.
+type Layer struct {
+	Name   string
+	Values map[string]string
+}
+
+// Process is the layer of the process environment.
+var Process = Layer{Name: "env"}
+
+var (
+	mu     sync.Mutex
+	layers = []Layer{Process}
+	looked = make(map[string]struct{})
+)
+
+// Use sets the layers in the order of precedence, the first layer having the
+// variable wins. Only the process environment is used by default.
+func Use(ls ...Layer) {
+	mu.Lock()
+	defer mu.Unlock()
+	layers = ls
+	looked = make(map[string]struct{})
+}
+
+// Unknown returns the variables of the layers that were never looked up by
+// name of the layer, i.e. the misspelled or unsupported settings.
+func Unknown() map[string][]string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	unknown := make(map[string][]string)
+	for _, l := range layers {
+		for name := range l.Values {
+			if _, ok := looked[name]; !ok {
+				unknown[l.Name] = append(unknown[l.Name], name)
+			}
+		}
+	}
+	for _, names := range unknown {
+		slices.Sort(names)
+	}
+	return unknown
+}
+
+func lookup(name string) (string, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	looked[name] = struct{}{}
+	for _, l := range layers {
+		if l.Name == Process.Name {
+			if v, ok := os.LookupEnv(name); ok {
+				return v, true
+			}
+			continue
+		}
+		if v, ok := l.Values[name]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
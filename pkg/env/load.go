@@ -0,0 +1,192 @@
+package env
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	bytesType    = reflect.TypeFor[Bytes]()
+	urlType      = reflect.TypeFor[*url.URL]()
+	mapType      = reflect.TypeFor[map[string]string]()
+	stringsType  = reflect.TypeFor[[]string]()
+	unmarshaler  = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// Load sets the fields of the struct pointed by dst from the variables named
+// by the "env" tags. The nested structs without the tag are loaded as well.
+// The other tags are:
+//
+//	default:"5s"     the value if the variable is not set
+//	required:"true"  the variable must be set if there is no default
+//	enum:"a,b"       the allowed values
+//	min:"1s"         the minimal value of a number, duration or size
+//
+// The fields of time.Duration, Bytes, *url.URL, []string, map[string]string,
+// encoding.TextUnmarshaler and the basic kinds are supported. Load reports
+// all the invalid variables at once.
+func Load(dst any) error {
+	return LoadPrefix("", dst)
+}
+
+// LoadPrefix is Load prepending the prefix to the variable names, so the
+// struct is shared by the binaries with the different prefixes.
+func LoadPrefix(prefix string, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("env.Load: pointer to struct expected, got %T", dst)
+	}
+	return errors.Join(loadStruct(prefix, v.Elem())...)
+}
+
+func loadStruct(prefix string, v reflect.Value) []error {
+	var errs []error
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, ok := f.Tag.Lookup("env")
+		if !ok {
+			if f.Type.Kind() == reflect.Struct {
+				errs = append(errs, loadStruct(prefix, v.Field(i))...)
+			}
+			continue
+		}
+
+		if err := loadField(v.Field(i), f, prefix+name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func loadField(v reflect.Value, f reflect.StructField, name string) error {
+	s, set := lookup(name)
+	if !set {
+		s, set = f.Tag.Lookup("default")
+		if !set {
+			if f.Tag.Get("required") == "true" {
+				return fmt.Errorf("env %s: %w", name, ErrNotSet)
+			}
+			return nil
+		}
+	}
+
+	if enum, ok := f.Tag.Lookup("enum"); ok {
+		if !slices.Contains(strings.Split(enum, ","), s) {
+			return fmt.Errorf("env %s invalid value: %q is not one of %s",
+				name, s, enum)
+		}
+	}
+
+	parsed := reflect.New(f.Type).Elem()
+	if err := setValue(parsed, s); err != nil {
+		return fmt.Errorf("env %s invalid '%s' value: %w", name, f.Type, err)
+	}
+
+	if minValue, ok := f.Tag.Lookup("min"); ok {
+		if err := checkMin(parsed, minValue); err != nil {
+			return fmt.Errorf("env %s invalid value: %w", name, err)
+		}
+	}
+
+	v.Set(parsed)
+	return nil
+}
+
+func setValue(v reflect.Value, s string) error {
+	if reflect.PointerTo(v.Type()).Implements(unmarshaler) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).
+			UnmarshalText([]byte(s))
+	}
+
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		v.SetInt(int64(d))
+		return err
+	case bytesType:
+		b, err := ParseBytes(s)
+		v.SetInt(int64(b))
+		return err
+	case urlType:
+		u, err := parseURL(s)
+		v.Set(reflect.ValueOf(u))
+		return err
+	case mapType:
+		m, err := parseMap(s)
+		v.Set(reflect.ValueOf(m))
+		return err
+	case stringsType:
+		v.Set(reflect.ValueOf(strings.Split(s, ",")))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return errors.New("unsupported type")
+	}
+	return nil
+}
+
+func checkMin(v reflect.Value, s string) error {
+	minValue := reflect.New(v.Type()).Elem()
+	if err := setValue(minValue, s); err != nil {
+		return fmt.Errorf("min %q: %w", s, err)
+	}
+
+	var less bool
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = v.Int() < minValue.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		less = v.Uint() < minValue.Uint()
+	case reflect.Float32, reflect.Float64:
+		less = v.Float() < minValue.Float()
+	default:
+		return fmt.Errorf("min is not supported by %s", v.Type())
+	}
+	if less {
+		return fmt.Errorf("%v is less than %v", v.Interface(), minValue.Interface())
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func Duration(
+	name string, validationFunc func(v time.Duration) error,
+) (time.Duration, error) {
+	return parse(name, "duration", time.ParseDuration, validationFunc)
+}
+
+func Bool(name string, validationFunc func(v bool) error) (bool, error) {
+	return parse(name, "bool", strconv.ParseBool, validationFunc)
+}
+
+func Float(name string, validationFunc func(v float64) error) (float64, error) {
+	return parse(name, "float",
+		func(v string) (float64, error) {
+			return strconv.ParseFloat(v, 64)
+		},
+		validationFunc,
+	)
+}
+
+func Size(name string, validationFunc func(v Bytes) error) (Bytes, error) {
+	return parse(name, "size", ParseBytes, validationFunc)
+}
+
+// URL requires the absolute URL.
+func URL(name string, validationFunc func(v *url.URL) error) (*url.URL, error) {
+	return parse(name, "url", parseURL, validationFunc)
+}
+
+// Enum requires one of the values.
+func Enum(name string, values ...string) (string, error) {
+	return parse(name, "enum",
+		func(v string) (string, error) {
+			if !slices.Contains(values, v) {
+				return "", fmt.Errorf(
+					"%q is not one of %s", v, strings.Join(values, ", "))
+			}
+			return v, nil
+		},
+		nil,
+	)
+}
+
+// Map reads the comma separated "key=value" pairs.
+func Map(
+	name string, validationFunc func(v map[string]string) error,
+) (map[string]string, error) {
+	return parse(name, "map", parseMap, validationFunc)
+}
+
+// Bytes is the size in bytes. It is set either in bytes or with the decimal
+// (kB, MB, GB) or binary (KiB, MiB, GiB) units, e.g. "200KiB".
+type Bytes int64
+
+var byteUnits = map[string]Bytes{
+	"":    1,
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+}
+
+func ParseBytes(s string) (Bytes, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	unit, ok := byteUnits[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit in %q", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	size := n * float64(unit)
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is out of range", s)
+	}
+	return Bytes(size), nil
+}
+
+func (b Bytes) String() string {
+	for _, u := range []string{"GiB", "MiB", "KiB"} {
+		if b >= byteUnits[u] && b%byteUnits[u] == 0 {
+			return strconv.FormatInt(int64(b/byteUnits[u]), 10) + u
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+func parseURL(v string) (*url.URL, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() || u.Host == "" && u.Opaque == "" {
+		return nil, errors.New("the absolute URL is required")
+	}
+	return u, nil
+}
+
+func parseMap(v string) (map[string]string, error) {
+	m := make(map[string]string)
+	if v == "" {
+		return m, nil
+	}
+	for pair := range strings.SplitSeq(v, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid pair %q, key=value expected", pair)
+		}
+		m[key] = strings.TrimSpace(value)
+	}
+	return m, nil
+}
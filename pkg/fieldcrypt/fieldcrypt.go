@@ -0,0 +1,226 @@
+// Package fieldcrypt encrypts single record fields with AES-GCM envelope
+// encryption. Each record is encrypted with a fresh data key, the data key is
+// wrapped by the active key of the keyring and travels with the record. The
+// keyring keeps the rotated keys, so the records encrypted before the
+// rotation are still decrypted. The values the records are looked up or
+// partitioned by are replaced with their MAC, which does not change on the
+// rotation.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	dataKeySize   = 32
+	minMACKeySize = 32
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown encryption key")
+	ErrDecrypt    = errors.New("failed to decrypt")
+	ErrNoKeyring  = errors.New("record is encrypted, keyring is not set")
+)
+
+// Envelope is the wrapped data key of a record and the ID of the keyring key
+// wrapping it.
+type Envelope struct {
+	KeyID   string
+	DataKey []byte
+}
+
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+	macKey []byte
+}
+
+// keyringFile is the keyring file format:
+//
+//	{
+//	  "active": "2025-01",
+//	  "keys": {"2024-07": "<base64>", "2025-01": "<base64>"},
+//	  "mac_key": "<base64>"
+//	}
+//
+// The keys are 16, 24 or 32 bytes long, the MAC key is 32 bytes at least.
+type keyringFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+	MACKey string            `json:"mac_key"`
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	const op = "fieldcrypt.LoadKeyring"
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var f keyringFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys := make(map[string][]byte, len(f.Keys))
+	for id, s := range f.Keys {
+		key, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", op, id, err)
+		}
+		keys[id] = key
+	}
+
+	macKey, err := base64.StdEncoding.DecodeString(f.MACKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: mac key: %w", op, err)
+	}
+
+	kr, err := NewKeyring(f.Active, keys, macKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return kr, nil
+}
+
+func NewKeyring(
+	active string, keys map[string][]byte, macKey []byte,
+) (*Keyring, error) {
+	const op = "fieldcrypt.NewKeyring"
+
+	if len(macKey) < minMACKeySize {
+		return nil, fmt.Errorf(
+			"%s: mac key is shorter than %d bytes", op, minMACKeySize)
+	}
+
+	kr := &Keyring{
+		active: active,
+		keys:   make(map[string]cipher.AEAD),
+		macKey: macKey,
+	}
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", op, id, err)
+		}
+		kr.keys[id] = aead
+	}
+	if _, ok := kr.keys[active]; !ok {
+		return nil, fmt.Errorf(
+			"%s: active key %q: %w", op, active, ErrUnknownKey)
+	}
+	return kr, nil
+}
+
+func (kr *Keyring) ActiveKeyID() string {
+	return kr.active
+}
+
+// MAC returns the hex encoded HMAC-SHA256 of the value. Unlike a plain hash
+// it cannot be brute-forced from a list of the known values without the key.
+func (kr *Keyring) MAC(v string) string {
+	mac := hmac.New(sha256.New, kr.macKey)
+	mac.Write([]byte(v))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypt replaces the values with their ciphertexts. The aad binds the
+// ciphertexts to the record, e.g. its UUID.
+func (kr *Keyring) Encrypt(aad string, values ...*string) (Envelope, error) {
+	const op = "Keyring.Encrypt"
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return Envelope{}, fmt.Errorf("%s: %w", op, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, v := range values {
+		ct, err := seal(aead, []byte(*v), []byte(aad))
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%s: %w", op, err)
+		}
+		*v = base64.StdEncoding.EncodeToString(ct)
+	}
+
+	wrapped, err := seal(kr.keys[kr.active], dataKey, []byte(kr.active))
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return Envelope{KeyID: kr.active, DataKey: wrapped}, nil
+}
+
+// Decrypt replaces the ciphertexts with the values.
+func (kr *Keyring) Decrypt(env Envelope, aad string, values ...*string) error {
+	const op = "Keyring.Decrypt"
+
+	kek, ok := kr.keys[env.KeyID]
+	if !ok {
+		return fmt.Errorf("%s: key %q: %w", op, env.KeyID, ErrUnknownKey)
+	}
+	dataKey, err := open(kek, env.DataKey, []byte(env.KeyID))
+	if err != nil {
+		return fmt.Errorf("%s: data key: %w", op, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, v := range values {
+		ct, err := base64.StdEncoding.DecodeString(*v)
+		if err != nil {
+			return fmt.Errorf("%s: %w: %w", op, ErrDecrypt, err)
+		}
+		pt, err := open(aead, ct, []byte(aad))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		*v = string(pt)
+	}
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns the nonce followed by the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(),
+		aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, b []byte, aad []byte) ([]byte, error) {
+	if len(b) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ct := b[:aead.NonceSize()], b[aead.NonceSize():]
+	pt, err := aead.Open(nil, nonce, ct, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return pt, nil
+}
@@ -0,0 +1,156 @@
+//go:build !integration
+
+package fieldcrypt_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, 32)
+	newKey = bytes.Repeat([]byte{2}, 32)
+	macKey = bytes.Repeat([]byte{3}, 32)
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	kr, err := fieldcrypt.NewKeyring("k1", map[string][]byte{"k1": oldKey}, macKey)
+	require.NoError(t, err)
+
+	email := "john.doe@example.com"
+	env, err := kr.Encrypt("uuid-1", &email)
+	require.NoError(t, err)
+	assert.Equal(t, "k1", env.KeyID)
+	assert.NotContains(t, email, "john.doe")
+
+	t.Run("wrong_aad", func(t *testing.T) {
+		v := email
+		err := kr.Decrypt(env, "uuid-2", &v)
+		assert.ErrorIs(t, err, fieldcrypt.ErrDecrypt)
+	})
+
+	t.Run("old_key_after_rotation", func(t *testing.T) {
+		rotated, err := fieldcrypt.NewKeyring(
+			"k2", map[string][]byte{"k1": oldKey, "k2": newKey}, macKey)
+		require.NoError(t, err)
+
+		v := email
+		require.NoError(t, rotated.Decrypt(env, "uuid-1", &v))
+		assert.Equal(t, "john.doe@example.com", v)
+
+		v = "john.doe@example.com"
+		env, err := rotated.Encrypt("uuid-1", &v)
+		require.NoError(t, err)
+		assert.Equal(t, "k2", env.KeyID)
+	})
+
+	t.Run("removed_key", func(t *testing.T) {
+		rotated, err := fieldcrypt.NewKeyring(
+			"k2", map[string][]byte{"k2": newKey}, macKey)
+		require.NoError(t, err)
+
+		v := email
+		err = rotated.Decrypt(env, "uuid-1", &v)
+		assert.ErrorIs(t, err, fieldcrypt.ErrUnknownKey)
+	})
+}
+
+func TestLoadKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	data := `{"active": "k2", "keys": {"k1": "` +
+		base64.StdEncoding.EncodeToString(oldKey) + `", "k2": "` +
+		base64.StdEncoding.EncodeToString(newKey) + `"}, "mac_key": "` +
+		base64.StdEncoding.EncodeToString(macKey) + `"}`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	kr, err := fieldcrypt.LoadKeyring(path)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", kr.ActiveKeyID())
+
+	_, err = fieldcrypt.NewKeyring(
+		"k3", map[string][]byte{"k1": oldKey}, macKey)
+	assert.ErrorIs(t, err, fieldcrypt.ErrUnknownKey)
+
+	_, err = fieldcrypt.NewKeyring(
+		"k1", map[string][]byte{"k1": oldKey}, macKey[:16])
+	assert.Error(t, err)
+}
+
+func TestMAC(t *testing.T) {
+	kr, err := fieldcrypt.NewKeyring("k1", map[string][]byte{"k1": oldKey}, macKey)
+	require.NoError(t, err)
+	rotated, err := fieldcrypt.NewKeyring(
+		"k2", map[string][]byte{"k1": oldKey, "k2": newKey}, macKey)
+	require.NoError(t, err)
+	other, err := fieldcrypt.NewKeyring(
+		"k1", map[string][]byte{"k1": oldKey}, newKey)
+	require.NoError(t, err)
+
+	mac := kr.MAC("john@example.com")
+	sum := sha256.Sum256([]byte("john@example.com"))
+	assert.NotEqual(t, hex.EncodeToString(sum[:]), mac)
+	assert.Equal(t, mac, rotated.MAC("john@example.com"))
+	assert.NotEqual(t, mac, other.MAC("john@example.com"))
+}
+
+func TestDecryptRecord(t *testing.T) {
+	kr, err := fieldcrypt.NewKeyring("k1", map[string][]byte{"k1": oldKey}, macKey)
+	require.NoError(t, err)
+
+	email := "john.doe@example.com"
+	env, err := kr.Encrypt("uuid-1", &email)
+	require.NoError(t, err)
+	rec := &kgo.Record{Headers: fieldcrypt.RecordHeaders(env, "email")}
+
+	t.Run("decrypt", func(t *testing.T) {
+		v := email
+		err := fieldcrypt.DecryptRecord(
+			kr, rec, "uuid-1", map[string]*string{"email": &v})
+		require.NoError(t, err)
+		assert.Equal(t, "john.doe@example.com", v)
+	})
+
+	t.Run("not_encrypted", func(t *testing.T) {
+		v := "john.doe@example.com"
+		err := fieldcrypt.DecryptRecord(
+			nil, &kgo.Record{}, "uuid-1", map[string]*string{"email": &v})
+		require.NoError(t, err)
+		assert.Equal(t, "john.doe@example.com", v)
+	})
+
+	t.Run("no_keyring", func(t *testing.T) {
+		v := email
+		err := fieldcrypt.DecryptRecord(
+			nil, rec, "uuid-1", map[string]*string{"email": &v})
+		assert.ErrorIs(t, err, fieldcrypt.ErrNoKeyring)
+		assert.True(t, fieldcrypt.IsMissingKey(err))
+	})
+
+	t.Run("unsupported_field", func(t *testing.T) {
+		v := email
+		err := fieldcrypt.DecryptRecord(
+			kr, rec, "uuid-1", map[string]*string{"phone": &v})
+		assert.Error(t, err)
+		assert.False(t, fieldcrypt.IsMissingKey(err))
+	})
+
+	t.Run("invalid_data_key", func(t *testing.T) {
+		_, _, err := fieldcrypt.ReadRecordHeaders(&kgo.Record{
+			Headers: []kgo.RecordHeader{
+				{Key: fieldcrypt.HeaderKeyID, Value: []byte("k1")},
+				{Key: fieldcrypt.HeaderDataKey, Value: []byte("not base64!")},
+			},
+		})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,100 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	HeaderKeyID   = "encryption-key-id"
+	HeaderDataKey = "encryption-data-key"
+	HeaderFields  = "encrypted-fields"
+)
+
+// RecordHeaders returns the headers the encrypted fields of the record are
+// decrypted by.
+func RecordHeaders(env Envelope, fields ...string) []kgo.RecordHeader {
+	return []kgo.RecordHeader{
+		{Key: HeaderKeyID, Value: []byte(env.KeyID)},
+		{Key: HeaderDataKey, Value: []byte(
+			base64.StdEncoding.EncodeToString(env.DataKey))},
+		{Key: HeaderFields, Value: []byte(strings.Join(fields, ","))},
+	}
+}
+
+// ReadRecordHeaders returns the envelope and the names of the encrypted
+// fields. The envelope is nil if the record is not encrypted.
+func ReadRecordHeaders(rec *kgo.Record) (*Envelope, []string, error) {
+	const op = "fieldcrypt.ReadRecordHeaders"
+
+	var (
+		env    *Envelope
+		fields []string
+	)
+	envelope := func() *Envelope {
+		if env == nil {
+			env = &Envelope{}
+		}
+		return env
+	}
+	for _, h := range rec.Headers {
+		switch h.Key {
+		case HeaderKeyID:
+			envelope().KeyID = string(h.Value)
+		case HeaderDataKey:
+			dataKey, err := base64.StdEncoding.DecodeString(string(h.Value))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: data key: %w", op, err)
+			}
+			envelope().DataKey = dataKey
+		case HeaderFields:
+			fields = strings.Split(string(h.Value), ",")
+		}
+	}
+	return env, fields, nil
+}
+
+// DecryptRecord decrypts the fields listed in the record headers, the fields
+// are looked up by their names. It returns ErrNoKeyring if the record is
+// encrypted and the keyring is nil.
+func DecryptRecord(
+	kr *Keyring, rec *kgo.Record, aad string, fields map[string]*string,
+) error {
+	const op = "fieldcrypt.DecryptRecord"
+
+	env, names, err := ReadRecordHeaders(rec)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if env == nil {
+		return nil
+	}
+	if kr == nil {
+		return fmt.Errorf("%s: %w", op, ErrNoKeyring)
+	}
+
+	values := make([]*string, 0, len(names))
+	for _, name := range names {
+		v, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("%s: unsupported encrypted field %q", op, name)
+		}
+		values = append(values, v)
+	}
+
+	if err := kr.Decrypt(*env, aad, values...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// IsMissingKey reports whether the record cannot be decrypted because the
+// keyring is not set or lacks its key. Skipping such records would lose
+// them, the consumer should stop instead.
+func IsMissingKey(err error) bool {
+	return errors.Is(err, ErrNoKeyring) || errors.Is(err, ErrUnknownKey)
+}
@@ -0,0 +1,46 @@
+//go:build !integration
+
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadyz(t *testing.T) {
+	mux := http.NewServeMux()
+	health.New().
+		Add("broker", func(context.Context) error { return nil }).
+		Add("topic", func(context.Context) error {
+			return errors.New("topic does not exist")
+		}).
+		Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var report health.Report
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	assert.Equal(t, health.Report{
+		Status: health.StatusFail,
+		Checks: map[string]health.CheckResult{
+			"broker": {Status: health.StatusOK},
+			"topic": {
+				Status: health.StatusFail, Error: "topic does not exist",
+			},
+		},
+	}, report)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
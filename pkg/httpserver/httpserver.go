@@ -3,56 +3,133 @@ package httpserver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/niksmo/receipt/pkg/env"
 	"github.com/niksmo/receipt/pkg/logger"
 )
 
-const (
-	readHeaderTimeout = 500 * time.Millisecond
-	readTimeout       = 2 * time.Second
-	idleTimeout       = 1 * time.Second
-	handlerTimeout    = 5 * time.Second
-	handlerTimeoutMsg = "service unavailable"
-)
+const handlerTimeoutMsg = "service unavailable"
+
+// Options are the server settings. The env variable names are prefixed by the
+// binary, e.g. RECEIPT_HTTP_READ_TIMEOUT.
+type Options struct {
+	ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" default:"500ms" min:"1ms"`
+	ReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT" default:"2s" min:"1ms"`
+	// WriteTimeout must exceed HandlerTimeout for the timeout response to be
+	// written.
+	WriteTimeout   time.Duration `env:"HTTP_WRITE_TIMEOUT" default:"10s" min:"1ms"`
+	IdleTimeout    time.Duration `env:"HTTP_IDLE_TIMEOUT" default:"1s" min:"1ms"`
+	HandlerTimeout time.Duration `env:"HTTP_HANDLER_TIMEOUT" default:"5s" min:"1ms"`
+	MaxHeaderBytes env.Bytes     `env:"HTTP_MAX_HEADER_BYTES" default:"1MiB" min:"1KiB"`
+	// MaxBodyBytes limits the request body, the larger bodies fail to be read
+	// with the *http.MaxBytesError.
+	MaxBodyBytes env.Bytes `env:"HTTP_MAX_BODY_BYTES" default:"4MiB" min:"1B"`
+	// HTTP2 enables HTTP/2 over TLS.
+	HTTP2 bool `env:"HTTP2" default:"true"`
+	// H2C enables HTTP/2 with prior knowledge over the cleartext
+	// connections, e.g. behind a proxy terminating TLS.
+	H2C bool `env:"HTTP_H2C" default:"false"`
+	TLS TLSOptions
+}
+
+// TLSOptions enable TLS when the certificate is set and the client
+// certificates verification when the client CA is set. The files are
+// reloaded on change.
+type TLSOptions struct {
+	CertFile     string `env:"TLS_CERT_FILE"`
+	KeyFile      string `env:"TLS_KEY_FILE"`
+	ClientCAFile string `env:"TLS_CLIENT_CA_FILE"`
+}
 
-type wrapper struct {
-	Status int
+func (o TLSOptions) Enabled() bool {
+	return o.CertFile != ""
+}
+
+// StatusWriter records the status of the response, it is 200 if the
+// handler does not write the header.
+type StatusWriter struct {
 	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w, status: http.StatusOK}
 }
 
-func (w *wrapper) WriteHeader(statusCode int) {
-	w.Status = statusCode
+func (w *StatusWriter) Status() int {
+	return w.status
+}
+
+func (w *StatusWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.status = statusCode
+		w.wroteHeader = true
+	}
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 type httpServer struct {
 	log logger.Logger
 	srv *http.Server
 }
 
 func New(
-	log logger.Logger, addr string, handler http.Handler,
-) *httpServer {
+	log logger.Logger, addr string, handler http.Handler, opts Options,
+) (*httpServer, error) {
+	const op = "httpserver.New"
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(opts.HTTP2)
+	protocols.SetUnencryptedHTTP2(opts.H2C)
+
 	srv := &http.Server{
 		Addr: addr,
-		Handler: http.TimeoutHandler(handler,
-			handlerTimeout, handlerTimeoutMsg),
-		ReadHeaderTimeout: 500 * time.Millisecond,
-		ReadTimeout:       2 * time.Second,
-		IdleTimeout:       1 * time.Second,
+		Handler: http.TimeoutHandler(
+			limitBody(handler, int64(opts.MaxBodyBytes)),
+			opts.HandlerTimeout, handlerTimeoutMsg),
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		ReadTimeout:       opts.ReadTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+		MaxHeaderBytes:    int(opts.MaxHeaderBytes),
+		Protocols:         &protocols,
+	}
+
+	if opts.TLS.Enabled() || opts.TLS.KeyFile != "" ||
+		opts.TLS.ClientCAFile != "" {
+		tlsConfig, err := newTLSConfig(log, opts.TLS, opts.HTTP2)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		srv.TLSConfig = tlsConfig
 	}
+
 	server := &httpServer{log, srv}
-	return server
+	return server, nil
 }
 
 func (s *httpServer) Run(stop context.CancelFunc) {
 	const op = "httpServer.Run"
 	log := s.log.WithOp(op)
 
-	log.Info().Str("addr", s.srv.Addr).Msg("http server is running")
-	err := s.srv.ListenAndServe()
+	log.Info().Str("addr", s.srv.Addr).Bool("tls", s.srv.TLSConfig != nil).
+		Msg("http server is running")
+
+	var err error
+	if s.srv.TLSConfig != nil {
+		err = s.srv.ListenAndServeTLS("", "")
+	} else {
+		err = s.srv.ListenAndServe()
+	}
 	if err != nil {
 		if errors.Is(err, http.ErrServerClosed) {
 			return
@@ -65,11 +142,17 @@ func (s *httpServer) Run(stop context.CancelFunc) {
 }
 
 func (s *httpServer) Close() {
-	const op = "httpServer.Close"
-	log := s.log.WithOp(op)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	s.Shutdown(ctx)
+}
+
+// Shutdown stops accepting connections and waits for the active requests
+// until the context is done.
+func (s *httpServer) Shutdown(ctx context.Context) {
+	const op = "httpServer.Shutdown"
+	log := s.log.WithOp(op)
+
 	log.Info().Msg("start closing server")
 	err := s.srv.Shutdown(ctx)
 	if err != nil {
@@ -78,3 +161,25 @@ func (s *httpServer) Close() {
 	}
 	log.Info().Msg("server closed")
 }
+
+func limitBody(next http.Handler, maxBytes int64) http.Handler {
+	if maxBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BodyTooLarge writes the response if the body exceeds the server limit.
+func BodyTooLarge(w http.ResponseWriter, log logger.Logger, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return false
+	}
+	errStr := fmt.Sprintf("body size limit is %d bytes", maxBytesErr.Limit)
+	http.Error(w, errStr, http.StatusRequestEntityTooLarge)
+	log.Info().Err(err).Msg(errStr)
+	return true
+}
@@ -0,0 +1,190 @@
+//go:build !integration
+
+package httpserver_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/internal/testcert"
+	"github.com/niksmo/receipt/pkg/httpserver"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeModified writes the file with the modification time the reloader
+// compares.
+func writeModified(t *testing.T, path string, b []byte, modTime time.Time) {
+	testcert.WriteFile(t, path, b)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+var readBody = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, err := io.ReadAll(r.Body)
+	if httpserver.BodyTooLarge(w, logger.New("disabled"), err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+})
+
+func runServer(t *testing.T, opts httpserver.Options) string {
+	addr := freeAddr(t)
+	srv, err := httpserver.New(logger.New("disabled"), addr, readBody, opts)
+	require.NoError(t, err)
+	go srv.Run(nil)
+	t.Cleanup(srv.Close)
+	return addr
+}
+
+func TestServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcert.NewCA(t)
+	opts := httpserver.Options{
+		ReadHeaderTimeout: time.Second,
+		ReadTimeout:       time.Second,
+		WriteTimeout:      2 * time.Second,
+		IdleTimeout:       time.Second,
+		HandlerTimeout:    time.Second,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      16,
+		HTTP2:             true,
+		TLS: httpserver.TLSOptions{
+			CertFile:     filepath.Join(dir, "tls.crt"),
+			KeyFile:      filepath.Join(dir, "tls.key"),
+			ClientCAFile: filepath.Join(dir, "ca.crt"),
+		},
+	}
+	modTime := time.Now().Add(-time.Minute)
+	certPEM, keyPEM := ca.Issue(t, "server-1", x509.ExtKeyUsageServerAuth)
+	writeModified(t, opts.TLS.CertFile, certPEM, modTime)
+	writeModified(t, opts.TLS.KeyFile, keyPEM, modTime)
+	writeModified(t, opts.TLS.ClientCAFile, ca.PEM(), modTime)
+
+	addr := runServer(t, opts)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+			ForceAttemptHTTP2: true,
+		}}
+	}
+	clientCertPEM, clientKeyPEM := ca.Issue(
+		t, "client", x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	require.NoError(t, err)
+
+	post := func(client *http.Client, body string) (*http.Response, error) {
+		return client.Post(
+			"https://"+addr, "text/plain", strings.NewReader(body))
+	}
+
+	var res *http.Response
+	require.Eventually(t, func() bool {
+		res, err = post(newClient(clientCert), "ok")
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 2, res.ProtoMajor)
+	assert.Equal(t, "server-1", res.TLS.PeerCertificates[0].Subject.CommonName)
+
+	t.Run("body_limit", func(t *testing.T) {
+		res, err := post(newClient(clientCert), strings.Repeat("x", 17))
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+
+	t.Run("client_cert_required", func(t *testing.T) {
+		_, err := post(newClient(), "ok")
+		assert.Error(t, err)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		certPEM, keyPEM := ca.Issue(t, "server-2", x509.ExtKeyUsageServerAuth)
+		writeModified(t, opts.TLS.CertFile, certPEM, time.Now())
+		writeModified(t, opts.TLS.KeyFile, keyPEM, time.Now())
+
+		assert.Eventually(t, func() bool {
+			res, err := post(newClient(clientCert), "ok")
+			if err != nil {
+				return false
+			}
+			res.Body.Close()
+			return res.TLS.PeerCertificates[0].Subject.CommonName == "server-2"
+		}, 3*time.Second, 100*time.Millisecond)
+	})
+}
+
+func TestServerH2C(t *testing.T) {
+	opts := httpserver.Options{
+		ReadHeaderTimeout: time.Second,
+		ReadTimeout:       time.Second,
+		WriteTimeout:      2 * time.Second,
+		IdleTimeout:       time.Second,
+		HandlerTimeout:    time.Second,
+		MaxHeaderBytes:    1 << 20,
+		HTTP2:             true,
+	}
+
+	// The client speaks HTTP/2 with prior knowledge only.
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	get := func(addr string) (*http.Response, error) {
+		return client.Get("http://" + addr)
+	}
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		addr := runServer(t, opts)
+		require.Eventually(t, func() bool {
+			conn, err := net.Dial("tcp", addr)
+			if err == nil {
+				conn.Close()
+			}
+			return err == nil
+		}, 2*time.Second, 10*time.Millisecond)
+
+		res, err := get(addr)
+		if err == nil {
+			res.Body.Close()
+		}
+		assert.Error(t, err)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		opts := opts
+		opts.H2C = true
+		addr := runServer(t, opts)
+
+		var res *http.Response
+		require.Eventually(t, func() bool {
+			var err error
+			res, err = get(addr)
+			return err == nil
+		}, 2*time.Second, 10*time.Millisecond)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, 2, res.ProtoMajor)
+	})
+}
@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/niksmo/receipt/pkg/logger"
+)
+
+// reloadCheckInterval limits how often the files are checked for changes,
+// the check is made on the TLS handshake.
+const reloadCheckInterval = time.Second
+
+// certReloader keeps the certificate and the client CA loaded from the files
+// and reloads them when the files are modified. The previous ones are kept
+// if the reload fails, e.g. the key is written after the certificate.
+type certReloader struct {
+	log        logger.Logger
+	opts       TLSOptions
+	nextProtos []string
+
+	mu       sync.Mutex
+	checked  time.Time
+	modTimes []time.Time
+	config   *tls.Config
+}
+
+func newTLSConfig(
+	log logger.Logger, opts TLSOptions, http2 bool,
+) (*tls.Config, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("both TLS certificate and key files are required")
+	}
+
+	nextProtos := []string{"http/1.1"}
+	if http2 {
+		nextProtos = []string{"h2", "http/1.1"}
+	}
+
+	r := &certReloader{log: log, opts: opts, nextProtos: nextProtos}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		NextProtos:         nextProtos,
+		GetConfigForClient: r.getConfigForClient,
+	}, nil
+}
+
+func (r *certReloader) getConfigForClient(
+	*tls.ClientHelloInfo,
+) (*tls.Config, error) {
+	const op = "certReloader.getConfigForClient"
+	log := r.log.WithOp(op)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= reloadCheckInterval {
+		r.checked = time.Now()
+		if r.modified() {
+			if err := r.reload(); err != nil {
+				log.Warn().Err(err).
+					Msg("failed to reload TLS files, keep the previous ones")
+			} else {
+				log.Info().Msg("TLS files reloaded")
+			}
+		}
+	}
+	return r.config, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) modified() bool {
+	for i, name := range r.files() {
+		fi, err := os.Stat(name)
+		if err != nil || !fi.ModTime().Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) reload() error {
+	var modTimes []time.Time
+	for _, name := range r.files() {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		modTimes = append(modTimes, fi.ModTime())
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("TLS certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   r.nextProtos,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("TLS client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf(
+				"TLS client CA: no certificates in %s", r.opts.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.modTimes = modTimes
+	r.config = config
+	return nil
+}
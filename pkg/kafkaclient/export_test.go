@@ -0,0 +1,3 @@
+package kafkaclient
+
+var TLSConfig = TLS.config
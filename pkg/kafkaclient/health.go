@@ -0,0 +1,49 @@
+package kafkaclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// CheckBroker checks the broker metadata is reachable.
+func CheckBroker(ctx context.Context, kcl *kgo.Client) error {
+	brokers, err := kadm.NewClient(kcl).BrokerMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	if len(brokers.Brokers) == 0 {
+		return errors.New("no brokers available")
+	}
+	return nil
+}
+
+// CheckTopics checks the topics exist.
+func CheckTopics(ctx context.Context, kcl *kgo.Client, topics ...string) error {
+	md, err := kadm.NewClient(kcl).Metadata(ctx, topics...)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, topic := range topics {
+		td, ok := md.Topics[topic]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("topic %q does not exist", topic))
+		case td.Err != nil:
+			errs = append(errs, fmt.Errorf("topic %q: %w", topic, td.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckGroup checks the client is a member of the consumer group.
+func CheckGroup(kcl *kgo.Client) error {
+	if _, generation := kcl.GroupMetadata(); generation < 0 {
+		return errors.New("not a consumer group member")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build !integration
+
+package kafkaclient_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestChecks(t *testing.T) {
+	ctx := context.Background()
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic))
+	require.NoError(t, err)
+	defer c.Close()
+
+	kcl, err := kgo.NewClient(kgo.SeedBrokers(c.ListenAddrs()...))
+	require.NoError(t, err)
+	defer kcl.Close()
+
+	assert.NoError(t, kafkaclient.CheckBroker(ctx, kcl))
+	assert.NoError(t, kafkaclient.CheckTopics(ctx, kcl, testTopic))
+	assert.ErrorContains(t,
+		kafkaclient.CheckTopics(ctx, kcl, testTopic, "missing"), `"missing"`)
+	assert.Error(t, kafkaclient.CheckGroup(kcl))
+}
@@ -0,0 +1,177 @@
+// Package kafkaclient builds the connection options shared by the Kafka
+// producers, consumers and admin clients.
+package kafkaclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const (
+	MechanismPlain       = "PLAIN"
+	MechanismScramSHA256 = "SCRAM-SHA-256"
+	MechanismScramSHA512 = "SCRAM-SHA-512"
+	MechanismOAuthBearer = "OAUTHBEARER"
+)
+
+// Security is the TLS and the SASL authentication of the connections. The
+// env variable names are prefixed by the binary, e.g. RECEIPT_KAFKA_TLS.
+type Security struct {
+	TLS  TLS
+	SASL SASL
+}
+
+// TLS is enabled by Enabled or by any of the files. The system roots are
+// used if the CA is not set, the client certificate is optional.
+type TLS struct {
+	Enabled    bool   `env:"KAFKA_TLS" default:"false"`
+	CAFile     string `env:"KAFKA_TLS_CA_FILE"`
+	CertFile   string `env:"KAFKA_TLS_CERT_FILE"`
+	KeyFile    string `env:"KAFKA_TLS_KEY_FILE"`
+	ServerName string `env:"KAFKA_TLS_SERVER_NAME"`
+}
+
+// SASL is enabled by the mechanism. The OAUTHBEARER token is read from the
+// file on every connection, so the token is rotated by rewriting the file.
+type SASL struct {
+	Mechanism string `env:"KAFKA_SASL_MECHANISM" enum:"PLAIN,SCRAM-SHA-256,SCRAM-SHA-512,OAUTHBEARER"`
+	Username  string `env:"KAFKA_SASL_USERNAME"`
+	Password  string `env:"KAFKA_SASL_PASSWORD" secret:"true"`
+	TokenFile string `env:"KAFKA_SASL_TOKEN_FILE"`
+}
+
+func (t TLS) enabled() bool {
+	return t.Enabled || t.CAFile != "" || t.CertFile != "" || t.KeyFile != ""
+}
+
+// Validate reports the incomplete settings and the unreadable files.
+func (s Security) Validate() error {
+	var errs []error
+
+	if s.TLS.enabled() {
+		if _, err := s.TLS.config(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch s.SASL.Mechanism {
+	case "":
+	case MechanismPlain, MechanismScramSHA256, MechanismScramSHA512:
+		if s.SASL.Username == "" || s.SASL.Password == "" {
+			errs = append(errs, fmt.Errorf(
+				"kafka SASL %s: username and password are required",
+				s.SASL.Mechanism))
+		}
+	case MechanismOAuthBearer:
+		if _, err := readToken(s.SASL.TokenFile); err != nil {
+			errs = append(errs, fmt.Errorf("kafka SASL %s: %w",
+				s.SASL.Mechanism, err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf(
+			"kafka SASL: unsupported mechanism %q", s.SASL.Mechanism))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Opts returns the options to connect to the seed brokers with.
+func Opts(seedBrokers []string, s Security) ([]kgo.Opt, error) {
+	const op = "kafkaclient.Opts"
+
+	opts := []kgo.Opt{kgo.SeedBrokers(seedBrokers...)}
+
+	if s.TLS.enabled() {
+		tlsCfg, err := s.TLS.config()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsCfg))
+	}
+
+	if s.SASL.Mechanism != "" {
+		mechanism, err := s.SASL.mechanism()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	return opts, nil
+}
+
+func (t TLS) config() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: t.ServerName}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka TLS CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf(
+				"kafka TLS CA: no certificates in %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka TLS client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func (s SASL) mechanism() (sasl.Mechanism, error) {
+	switch s.Mechanism {
+	case MechanismPlain:
+		return plain.Auth{User: s.Username, Pass: s.Password}.AsMechanism(), nil
+	case MechanismScramSHA256:
+		return scram.Auth{User: s.Username, Pass: s.Password}.
+			AsSha256Mechanism(), nil
+	case MechanismScramSHA512:
+		return scram.Auth{User: s.Username, Pass: s.Password}.
+			AsSha512Mechanism(), nil
+	case MechanismOAuthBearer:
+		tokenFile := s.TokenFile
+		return oauth.Oauth(func(context.Context) (oauth.Auth, error) {
+			token, err := readToken(tokenFile)
+			if err != nil {
+				return oauth.Auth{}, err
+			}
+			return oauth.Auth{Token: token}, nil
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported SASL mechanism %q", s.Mechanism)
+}
+
+func readToken(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("token file is required")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
@@ -0,0 +1,102 @@
+//go:build !integration
+
+package kafkaclient_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/niksmo/receipt/internal/testcert"
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("jwt\n"), 0o600))
+
+	valid := map[string]kafkaclient.Security{
+		"plaintext": {},
+		"tls":       {TLS: kafkaclient.TLS{Enabled: true}},
+		"scram": {SASL: kafkaclient.SASL{
+			Mechanism: kafkaclient.MechanismScramSHA512,
+			Username:  "receipt", Password: "secret",
+		}},
+		"oauth": {SASL: kafkaclient.SASL{
+			Mechanism: kafkaclient.MechanismOAuthBearer, TokenFile: tokenFile,
+		}},
+	}
+	for name, sec := range valid {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, sec.Validate())
+			opts, err := kafkaclient.Opts([]string{"localhost:9092"}, sec)
+			require.NoError(t, err)
+			assert.NotEmpty(t, opts)
+		})
+	}
+
+	invalid := map[string]kafkaclient.Security{
+		"missing_ca": {TLS: kafkaclient.TLS{CAFile: "/no/such/ca.crt"}},
+		"cert_without_key": {TLS: kafkaclient.TLS{
+			CertFile: "/no/such/tls.crt",
+		}},
+		"plain_without_password": {SASL: kafkaclient.SASL{
+			Mechanism: kafkaclient.MechanismPlain, Username: "receipt",
+		}},
+		"oauth_without_token": {SASL: kafkaclient.SASL{
+			Mechanism: kafkaclient.MechanismOAuthBearer,
+		}},
+		"unknown_mechanism": {SASL: kafkaclient.SASL{Mechanism: "GSSAPI"}},
+	}
+	for name, sec := range invalid {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, sec.Validate())
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcert.NewCA(t)
+	clientCert, clientKey := ca.Issue(t, "receipt", x509.ExtKeyUsageClientAuth)
+	client, err := tls.X509KeyPair(clientCert, clientKey)
+	require.NoError(t, err)
+	server, err := tls.X509KeyPair(
+		ca.Issue(t, "kafka-1", x509.ExtKeyUsageServerAuth))
+	require.NoError(t, err)
+
+	cfg, err := kafkaclient.TLSConfig(kafkaclient.TLS{
+		CAFile:     testcert.WriteFile(t, filepath.Join(dir, "ca.crt"), ca.PEM()),
+		CertFile:   testcert.WriteFile(t, filepath.Join(dir, "tls.crt"), clientCert),
+		KeyFile:    testcert.WriteFile(t, filepath.Join(dir, "tls.key"), clientKey),
+		ServerName: "kafka-1",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "kafka-1", cfg.ServerName)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	require.NotNil(t, cfg.RootCAs)
+	assert.True(t, roots.Equal(cfg.RootCAs))
+	_, err = server.Leaf.Verify(x509.VerifyOptions{
+		DNSName: cfg.ServerName, Roots: cfg.RootCAs,
+	})
+	assert.NoError(t, err)
+
+	require.Len(t, cfg.Certificates, 1)
+	require.NotEmpty(t, cfg.Certificates[0].Certificate)
+	assert.Equal(t, client.Certificate[0], cfg.Certificates[0].Certificate[0])
+
+	t.Run("system_roots", func(t *testing.T) {
+		cfg, err := kafkaclient.TLSConfig(kafkaclient.TLS{Enabled: true})
+		require.NoError(t, err)
+		assert.Nil(t, cfg.RootCAs)
+		assert.Empty(t, cfg.Certificates)
+		assert.Empty(t, cfg.ServerName)
+	})
+}
@@ -0,0 +1,24 @@
+package kafkaclient
+
+import (
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// ObserveLag sets the consumer lag of the fetched partitions, that is the
+// number of records between the committed offset of the group and the high
+// watermark. The gauges of the revoked and lost partitions are deleted by
+// the workers.
+func ObserveLag(kcl *kgo.Client, fetches kgo.Fetches) {
+	committed := kcl.CommittedOffsets()
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if p.Err != nil {
+			return
+		}
+		offset := p.LogStartOffset
+		if o, ok := committed[p.Topic][p.Partition]; ok && o.Offset >= 0 {
+			offset = o.Offset
+		}
+		metrics.SetConsumerLag(p.Topic, p.Partition, p.HighWatermark-offset)
+	})
+}
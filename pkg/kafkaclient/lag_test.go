@@ -0,0 +1,66 @@
+//go:build !integration
+
+package kafkaclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func scrapeMetrics() string {
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(
+		rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestObserveLag(t *testing.T) {
+	ctx := context.Background()
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1), kfake.SeedTopics(1, testTopic))
+	require.NoError(t, err)
+	defer c.Close()
+
+	kcl, err := kgo.NewClient(
+		kgo.SeedBrokers(c.ListenAddrs()...),
+		kgo.ConsumeTopics(testTopic),
+		kgo.ConsumerGroup("lag-group"),
+		kgo.DisableAutoCommit(),
+	)
+	require.NoError(t, err)
+	defer kcl.Close()
+
+	for range 5 {
+		kcl.Produce(ctx, &kgo.Record{Topic: testTopic}, nil)
+	}
+	require.NoError(t, kcl.Flush(ctx))
+
+	var fetches kgo.Fetches
+	for fetches.NumRecords() < 5 {
+		fetches = append(fetches, kcl.PollFetches(ctx)...)
+	}
+	require.NoError(t, kcl.CommitRecords(ctx, fetches.Records()[1]))
+
+	// The group committed two records of five, the fetched ones do not
+	// count.
+	kafkaclient.ObserveLag(kcl, fetches)
+	const lag = `receipt_kafka_consumer_lag{partition="0",topic="mail-outbox"}`
+	assert.Contains(t, scrapeMetrics(), lag+" 3")
+
+	ws := kafkaclient.NewWorkers(ctx, logger.New("disabled"), 1, nil)
+	defer ws.Close()
+	partitions := map[string][]int32{testTopic: {0}}
+	ws.Assigned(ctx, kcl, partitions)
+	ws.Revoked(ctx, kcl, partitions)
+	assert.NotContains(t, scrapeMetrics(), lag)
+}
@@ -0,0 +1,33 @@
+package kafkaclient
+
+import (
+	"context"
+	"errors"
+
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// CreateTopic creates the topic unless it already exists.
+func CreateTopic(
+	ctx context.Context,
+	log logger.Logger,
+	kcl *kgo.Client,
+	topic string, partitions int, repFactor int,
+) error {
+	log.Info().Str("topic", topic).Msg("initializing topic...")
+	_, err := kadm.NewClient(kcl).CreateTopic(
+		ctx, int32(partitions), int16(repFactor), nil, topic,
+	)
+	switch {
+	case errors.Is(err, kerr.TopicAlreadyExists):
+		log.Info().Str("topic", topic).Msg("topic already exists")
+	case err != nil:
+		return err
+	default:
+		log.Info().Str("topic", topic).Msg("topic created")
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package kafkaclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// ErrWorkerStopped is reported for the queued batches of a revoked or lost
+// partition, they are left to the next owner.
+var ErrWorkerStopped = errors.New("partition worker is stopped")
+
+// BatchHandler handles the records of a single partition. The context is
+// canceled when the partition is lost or the workers are aborted.
+type BatchHandler func(
+	ctx context.Context, w *PartitionWorker, recs []*kgo.Record,
+) error
+
+// Workers runs a worker per assigned partition, so a slow partition does not
+// stall the others. Assigned, Revoked and Lost are meant to be called from
+// the client partition callbacks, the consumer lag of the revoked and lost
+// partitions is deleted with their workers.
+type Workers struct {
+	log      logger.Logger
+	handle   BatchHandler
+	queueLen int
+	ctx      context.Context
+	cancel   context.CancelFunc
+	paused   atomic.Int64 // nanoseconds
+	mu       sync.Mutex
+	workers  map[TopicPartition]*PartitionWorker
+}
+
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// NewWorkers creates the workers. The partition fetching is paused while
+// queueLen batches are waiting for its worker, so the poll loop is never
+// blocked. The backlog pause is disabled if queueLen is zero, for the poll
+// loops waiting for every submitted batch anyway. Canceling ctx aborts the
+// in-flight batches.
+func NewWorkers(
+	ctx context.Context, log logger.Logger, queueLen int, handle BatchHandler,
+) *Workers {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Workers{
+		log:      log,
+		handle:   handle,
+		queueLen: max(queueLen, 0),
+		ctx:      ctx,
+		cancel:   cancel,
+		workers:  make(map[TopicPartition]*PartitionWorker),
+	}
+}
+
+// Submit queues the fetched records to the partition worker. The done
+// callback, if any, is called once the batch is handled or dropped. Submit
+// reports false if the partition is not assigned.
+func (ws *Workers) Submit(
+	p kgo.FetchTopicPartition, done func(err error),
+) bool {
+	ws.mu.Lock()
+	w, ok := ws.workers[TopicPartition{p.Topic, p.Partition}]
+	ws.mu.Unlock()
+	if !ok {
+		return false
+	}
+	w.enqueue(workerBatch{p.Records, done})
+	return true
+}
+
+func (ws *Workers) Assigned(
+	_ context.Context, kcl *kgo.Client, assigned map[string][]int32,
+) {
+	const op = "Workers.Assigned"
+	log := ws.log.WithOp(op)
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for topic, partitions := range assigned {
+		for _, partition := range partitions {
+			tp := TopicPartition{topic, partition}
+			w := newPartitionWorker(ws, kcl, tp)
+			ws.workers[tp] = w
+			go w.run()
+		}
+		log.Info().Str("topic", topic).Ints32(
+			"partitions", partitions).Msg("partitions assigned")
+	}
+}
+
+// Revoked lets the workers of the revoked partitions finish their in-flight
+// batches and waits for them. The queued batches are dropped.
+func (ws *Workers) Revoked(
+	_ context.Context, _ *kgo.Client, revoked map[string][]int32,
+) {
+	const op = "Workers.Revoked"
+	log := ws.log.WithOp(op)
+
+	for _, w := range ws.remove(revoked) {
+		w.stop()
+		w.wait()
+	}
+	log.Info().Any("partitions", revoked).Msg("partitions revoked")
+}
+
+// Lost aborts the in-flight batches of the lost partitions and waits for
+// the workers.
+func (ws *Workers) Lost(
+	_ context.Context, _ *kgo.Client, lost map[string][]int32,
+) {
+	const op = "Workers.Lost"
+	log := ws.log.WithOp(op)
+
+	for _, w := range ws.remove(lost) {
+		w.abort()
+		w.wait()
+	}
+	log.Warn().Any("partitions", lost).Msg("partitions lost")
+}
+
+// Stop lets all the workers finish their in-flight batches and waits for
+// them. The queued batches are dropped.
+func (ws *Workers) Stop() {
+	workers := ws.removeAll()
+	for _, w := range workers {
+		w.stop()
+	}
+	for _, w := range workers {
+		w.wait()
+	}
+}
+
+// Abort interrupts the in-flight batches of all the workers.
+func (ws *Workers) Abort() {
+	ws.cancel()
+}
+
+// Close aborts all the workers and waits for them.
+func (ws *Workers) Close() {
+	ws.cancel()
+	for _, w := range ws.removeAll() {
+		w.abort()
+		w.wait()
+	}
+}
+
+// PausedTime returns the total time the partitions fetching was paused.
+func (ws *Workers) PausedTime() time.Duration {
+	return time.Duration(ws.paused.Load())
+}
+
+func (ws *Workers) remove(
+	partitions map[string][]int32,
+) []*PartitionWorker {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	var removed []*PartitionWorker
+	for topic, ps := range partitions {
+		for _, partition := range ps {
+			tp := TopicPartition{topic, partition}
+			if w, ok := ws.workers[tp]; ok {
+				delete(ws.workers, tp)
+				removed = append(removed, w)
+			}
+			metrics.DeleteConsumerLag(topic, partition)
+		}
+	}
+	return removed
+}
+
+func (ws *Workers) removeAll() map[TopicPartition]*PartitionWorker {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	workers := ws.workers
+	ws.workers = make(map[TopicPartition]*PartitionWorker)
+	return workers
+}
+
+type workerBatch struct {
+	recs []*kgo.Record
+	done func(err error)
+}
+
+// PartitionWorker handles the batches of a single partition in order.
+type PartitionWorker struct {
+	ws     *Workers
+	log    logger.Logger
+	kcl    *kgo.Client
+	tp     TopicPartition
+	ctx    context.Context
+	cancel context.CancelFunc
+	wake   chan struct{}
+	quit   chan struct{}
+	done   chan struct{}
+
+	mu          sync.Mutex
+	released    bool
+	queue       []workerBatch
+	backlogged  bool
+	throttled   bool
+	fetchPaused time.Time // zero if fetching is not paused
+}
+
+func newPartitionWorker(
+	ws *Workers, kcl *kgo.Client, tp TopicPartition,
+) *PartitionWorker {
+	ctx, cancel := context.WithCancel(ws.ctx)
+	return &PartitionWorker{
+		ws:     ws,
+		log:    ws.log,
+		kcl:    kcl,
+		tp:     tp,
+		ctx:    ctx,
+		cancel: cancel,
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (w *PartitionWorker) Topic() string {
+	return w.tp.Topic
+}
+
+func (w *PartitionWorker) Partition() int32 {
+	return w.tp.Partition
+}
+
+// Pause stops fetching the partition for the given duration, so the records
+// do not pile up while the downstream is saturated. It reports false if the
+// worker is stopped meanwhile, the handler should return then.
+func (w *PartitionWorker) Pause(d time.Duration) bool {
+	const op = "PartitionWorker.Pause"
+	log := w.logger(op)
+
+	w.mu.Lock()
+	w.throttled = true
+	w.syncFetch()
+	w.mu.Unlock()
+	log.Warn().Dur("duration", d).Msg("partition paused")
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	var resumed bool
+	select {
+	case <-timer.C:
+		resumed = true
+	case <-w.quit:
+	case <-w.ctx.Done():
+	}
+
+	w.mu.Lock()
+	w.throttled = false
+	w.syncFetch()
+	w.mu.Unlock()
+	log.Info().Msg("partition resumed")
+	return resumed
+}
+
+func (w *PartitionWorker) run() {
+	defer close(w.done)
+	defer w.cancel()
+	defer w.release()
+
+	for {
+		b, ok := w.next()
+		if !ok {
+			select {
+			case <-w.quit:
+				return
+			case <-w.wake:
+				continue
+			}
+		}
+
+		select {
+		case <-w.quit:
+			w.finish(b, ErrWorkerStopped)
+			return
+		default:
+		}
+		w.finish(b, w.ws.handle(w.ctx, w, b.recs))
+	}
+}
+
+func (w *PartitionWorker) enqueue(b workerBatch) {
+	const op = "PartitionWorker.enqueue"
+
+	w.mu.Lock()
+	if w.released {
+		w.mu.Unlock()
+		w.finish(b, ErrWorkerStopped)
+		return
+	}
+	w.queue = append(w.queue, b)
+	if w.ws.queueLen > 0 && len(w.queue) >= w.ws.queueLen && !w.backlogged {
+		w.backlogged = true
+		w.syncFetch()
+		log := w.logger(op)
+		log.Debug().Int(
+			"nQueued", len(w.queue)).Msg("partition backlogged, fetching paused")
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next pops the oldest queued batch and resumes fetching once the backlog
+// is below the limit.
+func (w *PartitionWorker) next() (workerBatch, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.queue) == 0 {
+		return workerBatch{}, false
+	}
+	b := w.queue[0]
+	w.queue = w.queue[1:]
+	if w.backlogged && len(w.queue) < w.ws.queueLen {
+		w.backlogged = false
+		w.syncFetch()
+	}
+	return b, true
+}
+
+// stop lets the worker finish the in-flight batch.
+func (w *PartitionWorker) stop() {
+	close(w.quit)
+	w.drop()
+}
+
+// abort interrupts the in-flight batch.
+func (w *PartitionWorker) abort() {
+	w.cancel()
+	close(w.quit)
+	w.drop()
+}
+
+func (w *PartitionWorker) wait() {
+	<-w.done
+}
+
+// drop drops the queued batches, they are left to the next owner.
+func (w *PartitionWorker) drop() {
+	w.mu.Lock()
+	w.released = true
+	queue := w.queue
+	w.queue = nil
+	w.mu.Unlock()
+
+	for _, b := range queue {
+		w.finish(b, ErrWorkerStopped)
+	}
+}
+
+// release resumes fetching, so the partition is not left paused if it is
+// assigned again.
+func (w *PartitionWorker) release() {
+	w.mu.Lock()
+	w.backlogged, w.throttled = false, false
+	w.syncFetch()
+	w.mu.Unlock()
+	w.drop()
+}
+
+func (w *PartitionWorker) finish(b workerBatch, err error) {
+	if b.done != nil {
+		b.done(err)
+	}
+}
+
+// syncFetch pauses or resumes fetching the partition. It must be called
+// with the lock held.
+func (w *PartitionWorker) syncFetch() {
+	pause := w.backlogged || w.throttled
+	paused := !w.fetchPaused.IsZero()
+	partitions := map[string][]int32{w.tp.Topic: {w.tp.Partition}}
+
+	switch {
+	case pause && !paused:
+		w.kcl.PauseFetchPartitions(partitions)
+		w.fetchPaused = time.Now()
+	case !pause && paused:
+		w.kcl.ResumeFetchPartitions(partitions)
+		d := time.Since(w.fetchPaused)
+		w.fetchPaused = time.Time{}
+		w.ws.paused.Add(int64(d))
+		metrics.AddPaused(w.tp.Topic, d)
+	}
+}
+
+func (w *PartitionWorker) logger(op string) logger.Logger {
+	return logger.Logger{Logger: w.log.WithOp(op).With().Str(
+		"topic", w.tp.Topic).Int32("partition", w.tp.Partition).Logger()}
+}
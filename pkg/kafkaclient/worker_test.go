@@ -0,0 +1,305 @@
+//go:build !integration
+
+package kafkaclient_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niksmo/receipt/pkg/kafkaclient"
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const testTopic = "mail-outbox"
+
+// blockingHandler records the handled offsets and blocks the batches of
+// the partition until it is released.
+type blockingHandler struct {
+	mu      sync.Mutex
+	handled map[int32][]int64
+	started chan int32
+	release map[int32]chan struct{}
+	errs    chan error
+}
+
+func newBlockingHandler(blocked ...int32) *blockingHandler {
+	h := &blockingHandler{
+		handled: make(map[int32][]int64),
+		started: make(chan int32, 16),
+		release: make(map[int32]chan struct{}),
+		errs:    make(chan error, 16),
+	}
+	for _, p := range blocked {
+		h.release[p] = make(chan struct{})
+	}
+	return h
+}
+
+func (h *blockingHandler) handle(
+	ctx context.Context, w *kafkaclient.PartitionWorker, recs []*kgo.Record,
+) error {
+	h.started <- w.Partition()
+	if release, ok := h.release[w.Partition()]; ok {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			h.errs <- ctx.Err()
+			return ctx.Err()
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range recs {
+		h.handled[w.Partition()] = append(h.handled[w.Partition()], r.Offset)
+	}
+	return nil
+}
+
+func (h *blockingHandler) offsets(partition int32) []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]int64(nil), h.handled[partition]...)
+}
+
+func newTestClient(t *testing.T) *kgo.Client {
+	t.Helper()
+	// The client never connects, it only keeps the paused partitions.
+	kcl, err := kgo.NewClient(
+		kgo.SeedBrokers("127.0.0.1:1"), kgo.ConsumeTopics(testTopic))
+	require.NoError(t, err)
+	t.Cleanup(kcl.Close)
+	return kcl
+}
+
+func newTestWorkers(
+	t *testing.T, kcl *kgo.Client, queueLen int, h kafkaclient.BatchHandler,
+	partitions ...int32,
+) *kafkaclient.Workers {
+	t.Helper()
+	ws := kafkaclient.NewWorkers(
+		context.Background(), logger.New("disabled"), queueLen, h)
+	ws.Assigned(context.Background(), kcl, map[string][]int32{
+		testTopic: partitions,
+	})
+	t.Cleanup(ws.Close)
+	return ws
+}
+
+func fetched(partition int32, offsets ...int64) kgo.FetchTopicPartition {
+	p := kgo.FetchTopicPartition{Topic: testTopic}
+	p.Partition = partition
+	for _, o := range offsets {
+		p.Records = append(p.Records, &kgo.Record{
+			Topic: testTopic, Partition: partition, Offset: o,
+		})
+	}
+	return p
+}
+
+func isPaused(kcl *kgo.Client, partition int32) bool {
+	for _, p := range kcl.PauseFetchPartitions(nil)[testTopic] {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+func collect(errs chan error) func(error) {
+	return func(err error) { errs <- err }
+}
+
+func TestWorkers(t *testing.T) {
+	t.Run("slow_partition_does_not_stall_others", func(t *testing.T) {
+		kcl := newTestClient(t)
+		h := newBlockingHandler(0)
+		ws := newTestWorkers(t, kcl, 4, h.handle, 0, 1)
+
+		done := make(chan error, 2)
+		require.True(t, ws.Submit(fetched(0, 0, 1), collect(done)))
+		require.True(t, ws.Submit(fetched(1, 0, 1), collect(done)))
+
+		require.NoError(t, <-done)
+		assert.Equal(t, []int64{0, 1}, h.offsets(1))
+		assert.Empty(t, h.offsets(0))
+
+		close(h.release[0])
+		require.NoError(t, <-done)
+		assert.Equal(t, []int64{0, 1}, h.offsets(0))
+	})
+
+	t.Run("not_assigned", func(t *testing.T) {
+		ws := newTestWorkers(t, newTestClient(t), 4, newBlockingHandler().handle, 0)
+		assert.False(t, ws.Submit(fetched(1, 0), nil))
+	})
+
+	t.Run("backlog_pauses_fetching", func(t *testing.T) {
+		kcl := newTestClient(t)
+		h := newBlockingHandler(0)
+		ws := newTestWorkers(t, kcl, 2, h.handle, 0)
+
+		done := make(chan error, 3)
+		// The first batch is in-flight, the others are queued.
+		require.True(t, ws.Submit(fetched(0, 0), collect(done)))
+		<-h.started
+		require.True(t, ws.Submit(fetched(0, 1), collect(done)))
+		assert.False(t, isPaused(kcl, 0))
+		require.True(t, ws.Submit(fetched(0, 2), collect(done)))
+		assert.True(t, isPaused(kcl, 0))
+
+		close(h.release[0])
+		for range 3 {
+			require.NoError(t, <-done)
+		}
+		assert.Equal(t, []int64{0, 1, 2}, h.offsets(0))
+		assert.False(t, isPaused(kcl, 0))
+		assert.Positive(t, ws.PausedTime())
+	})
+
+	t.Run("backlog_pause_disabled", func(t *testing.T) {
+		kcl := newTestClient(t)
+		h := newBlockingHandler(0)
+		ws := newTestWorkers(t, kcl, 0, h.handle, 0)
+
+		done := make(chan error, 2)
+		require.True(t, ws.Submit(fetched(0, 0), collect(done)))
+		<-h.started
+		require.True(t, ws.Submit(fetched(0, 1), collect(done)))
+		assert.False(t, isPaused(kcl, 0))
+
+		close(h.release[0])
+		for range 2 {
+			require.NoError(t, <-done)
+		}
+		assert.Equal(t, []int64{0, 1}, h.offsets(0))
+		assert.Zero(t, ws.PausedTime())
+	})
+
+	t.Run("revoke_while_busy", func(t *testing.T) {
+		kcl := newTestClient(t)
+		h := newBlockingHandler(0)
+		ws := newTestWorkers(t, kcl, 1, h.handle, 0)
+
+		done := make(chan error, 2)
+		require.True(t, ws.Submit(fetched(0, 0), collect(done)))
+		<-h.started
+		require.True(t, ws.Submit(fetched(0, 1), collect(done)))
+		require.True(t, isPaused(kcl, 0))
+
+		revoked := make(chan struct{})
+		go func() {
+			ws.Revoked(context.Background(), kcl, map[string][]int32{
+				testTopic: {0},
+			})
+			close(revoked)
+		}()
+
+		// The queued batch is dropped, the in-flight one is finished.
+		assert.ErrorIs(t, <-done, kafkaclient.ErrWorkerStopped)
+		select {
+		case <-revoked:
+			t.Fatal("revoke returned before the in-flight batch is finished")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(h.release[0])
+		require.NoError(t, <-done)
+		<-revoked
+		assert.Equal(t, []int64{0}, h.offsets(0))
+		assert.False(t, isPaused(kcl, 0))
+		assert.False(t, ws.Submit(fetched(0, 1), nil))
+	})
+
+	t.Run("lost_aborts_in_flight", func(t *testing.T) {
+		kcl := newTestClient(t)
+		h := newBlockingHandler(0)
+		ws := newTestWorkers(t, kcl, 4, h.handle, 0)
+
+		done := make(chan error, 1)
+		require.True(t, ws.Submit(fetched(0, 0), collect(done)))
+		<-h.started
+
+		ws.Lost(context.Background(), kcl, map[string][]int32{testTopic: {0}})
+		assert.ErrorIs(t, <-done, context.Canceled)
+		assert.ErrorIs(t, <-h.errs, context.Canceled)
+		assert.Empty(t, h.offsets(0))
+	})
+
+	t.Run("stop_finishes_in_flight", func(t *testing.T) {
+		kcl := newTestClient(t)
+		h := newBlockingHandler(0, 1)
+		ws := newTestWorkers(t, kcl, 4, h.handle, 0, 1)
+
+		done := make(chan error, 3)
+		require.True(t, ws.Submit(fetched(0, 0), collect(done)))
+		require.True(t, ws.Submit(fetched(1, 0), collect(done)))
+		<-h.started
+		<-h.started
+		require.True(t, ws.Submit(fetched(0, 1), collect(done)))
+
+		stopped := make(chan struct{})
+		go func() {
+			ws.Stop()
+			close(stopped)
+		}()
+
+		assert.ErrorIs(t, <-done, kafkaclient.ErrWorkerStopped)
+		close(h.release[0])
+		close(h.release[1])
+		require.NoError(t, <-done)
+		require.NoError(t, <-done)
+		<-stopped
+		assert.Equal(t, []int64{0}, h.offsets(0))
+		assert.Equal(t, []int64{0}, h.offsets(1))
+		assert.False(t, ws.Submit(fetched(0, 2), nil))
+	})
+
+	t.Run("pause", func(t *testing.T) {
+		kcl := newTestClient(t)
+		resumed := make(chan bool, 1)
+		ws := newTestWorkers(t, kcl, 4, func(
+			_ context.Context, w *kafkaclient.PartitionWorker, _ []*kgo.Record,
+		) error {
+			resumed <- w.Pause(100 * time.Millisecond)
+			return nil
+		}, 0)
+
+		done := make(chan error, 1)
+		require.True(t, ws.Submit(fetched(0, 0), collect(done)))
+		require.Eventually(t, func() bool { return isPaused(kcl, 0) },
+			time.Second, time.Millisecond)
+
+		assert.True(t, <-resumed)
+		require.NoError(t, <-done)
+		assert.False(t, isPaused(kcl, 0))
+		assert.GreaterOrEqual(t, ws.PausedTime(), 100*time.Millisecond)
+	})
+
+	t.Run("pause_interrupted_by_revoke", func(t *testing.T) {
+		kcl := newTestClient(t)
+		pausing := make(chan struct{})
+		resumed := make(chan bool, 1)
+		ws := newTestWorkers(t, kcl, 4, func(
+			_ context.Context, w *kafkaclient.PartitionWorker, _ []*kgo.Record,
+		) error {
+			close(pausing)
+			resumed <- w.Pause(time.Hour)
+			return nil
+		}, 0)
+
+		require.True(t, ws.Submit(fetched(0, 0), nil))
+		<-pausing
+		require.Eventually(t, func() bool { return isPaused(kcl, 0) },
+			time.Second, time.Millisecond)
+
+		ws.Revoked(context.Background(), kcl, map[string][]int32{testTopic: {0}})
+		assert.False(t, <-resumed)
+		assert.False(t, isPaused(kcl, 0))
+	})
+}
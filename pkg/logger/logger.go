@@ -1,8 +1,11 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 
 	"github.com/rs/zerolog"
 )
@@ -14,10 +17,18 @@ type Logger struct {
 }
 
 func New(level string) Logger {
+	return NewWithWriter(level, os.Stderr)
+}
+
+// NewWithWriter returns the logger writing to w. The personal data of
+// customers is masked in the errors and in the fields added with PII, the
+// messages are written as is and must not carry it.
+func NewWithWriter(level string, w io.Writer) Logger {
 	setLevel(level)
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+	zerolog.ErrorMarshalFunc = marshalError
 	return Logger{
-		zerolog.New(os.Stderr).With().Timestamp().Logger(),
+		zerolog.New(w).With().Timestamp().Logger(),
 	}
 }
 
@@ -38,3 +49,55 @@ func setLevel(level string) {
 func (l Logger) WithOp(op string) Logger {
 	return Logger{l.With().Str("op", op).Logger()}
 }
+
+type ctxKey struct{}
+
+// scope is the request scoped logger with the fields added by the handler.
+// The access log reads it while the handler may still be running, e.g. after
+// http.TimeoutHandler answered, so the fields are guarded.
+type scope struct {
+	log    Logger
+	mu     sync.Mutex
+	fields []string // key, value pairs
+}
+
+// NewContext returns the context carrying the request scoped logger.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &scope{log: l})
+}
+
+// Ctx returns the request scoped logger or l if the context carries none.
+func (l Logger) Ctx(ctx context.Context) Logger {
+	sc, ok := ctx.Value(ctxKey{}).(*scope)
+	if !ok {
+		return l
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if len(sc.fields) == 0 {
+		return sc.log
+	}
+	c := sc.log.With()
+	for i := 0; i < len(sc.fields); i += 2 {
+		c = c.Str(sc.fields[i], sc.fields[i+1])
+	}
+	return Logger{c.Logger()}
+}
+
+// AddStr adds the field to the request scoped logger, so it is written by the
+// loggers taken from the context afterwards. It is safe for concurrent use.
+func AddStr(ctx context.Context, key string, value string) {
+	if sc, ok := ctx.Value(ctxKey{}).(*scope); ok {
+		sc.mu.Lock()
+		sc.fields = append(sc.fields, key, value)
+		sc.mu.Unlock()
+	}
+}
+
+// ValidateLevel returns an error if the level is unknown.
+func ValidateLevel(level string) error {
+	if _, err := zerolog.ParseLevel(level); err != nil {
+		return fmt.Errorf("invalid log level: %q", level)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+//go:build !integration
+
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWithWriter("debug", &buf)
+
+	log.Info().Func(logger.PII("to", "john.doe@example.com")).Func(
+		logger.PII("inn", "7707083893")).Func(
+		logger.PII("phone", "+79991234567")).Func(
+		logger.PII("address", "Moscow")).Send()
+	log.Error().Err(errors.New(
+		"rejected john.doe@example.com, phone +7 999 123-45-67, inn 7707083893",
+	)).Msg("failed to send mail")
+
+	out := buf.String()
+	assert.NotContains(t, out, "john.doe")
+	assert.NotContains(t, out, "7707083893")
+	assert.NotContains(t, out, "+79991234567")
+	assert.NotContains(t, out, "123-45-67")
+	assert.NotContains(t, out, "Moscow")
+	assert.Contains(t, out, `"to":"j***@example.com"`)
+	assert.Contains(t, out, `"inn":"******3893"`)
+	assert.Contains(t, out, `"phone":"+*********67"`)
+	assert.Contains(t, out, `"address":"***"`)
+	assert.Contains(t, out, `"message":"failed to send mail"`)
+}
+
+func TestContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWithWriter("debug", &buf)
+	ctx := logger.NewContext(context.Background(), log)
+
+	// The handler adds the fields while the access log reads the logger.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 100 {
+			logger.AddStr(ctx, fmt.Sprint("k", i), "v")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			_ = log.Ctx(ctx)
+		}
+	}()
+	wg.Wait()
+
+	scoped := log.Ctx(ctx)
+	scoped.Info().Msg("done")
+	assert.Contains(t, buf.String(), `"k0":"v"`)
+	assert.Contains(t, buf.String(), `"k99":"v"`)
+
+	buf.Reset()
+	unscoped := log.Ctx(context.Background())
+	unscoped.Info().Msg("no scope")
+	assert.NotContains(t, buf.String(), `"k0"`)
+}
@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"github.com/niksmo/receipt/pkg/redact"
+	"github.com/rs/zerolog"
+)
+
+// PII adds the personal data field masked by the rule of its name, the value
+// is masked entirely if the name has no rule, e.g.
+//
+//	log.Debug().Func(logger.PII("to", email)).Send()
+func PII(key string, value string) func(*zerolog.Event) {
+	return func(e *zerolog.Event) {
+		rule, ok := redact.FieldRules[key]
+		if !ok {
+			rule = redact.All
+		}
+		e.Str(key, rule(value))
+	}
+}
+
+// marshalError masks the personal data in the error messages, they are free
+// text and may quote the rejected values.
+func marshalError(err error) any {
+	return redact.Text(err.Error())
+}
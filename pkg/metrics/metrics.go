@@ -0,0 +1,200 @@
+// Package metrics defines the Prometheus metrics shared by the binaries.
+// The vector metrics are exposed once they are observed, so each binary
+// exposes only the metrics it uses.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/niksmo/receipt/pkg/httpserver"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "receipt"
+
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route and status.",
+	}, []string{"route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	produceDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "kafka_produce_duration_seconds",
+		Help:      "Kafka produce latency by topic and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"topic", "result"})
+
+	produceErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_produce_errors_total",
+		Help:      "Number of records failed to produce by topic.",
+	}, []string{"topic"})
+
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_lag",
+		Help:      "Records after the committed offset by topic and partition.",
+	}, []string{"topic", "partition"})
+
+	groupLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_group_lag",
+		Help:      "Records the consumer group is behind by topic and partition.",
+	}, []string{"group", "topic", "partition"})
+
+	oldestRecordAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_group_oldest_record_age_seconds",
+		Help:      "Age of the oldest unprocessed record by topic and partition.",
+	}, []string{"group", "topic", "partition"})
+
+	oldestRecordAgeUnknown = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_group_oldest_record_age_unknown",
+		Help:      "One if the oldest record age is unknown by topic and partition.",
+	}, []string{"group", "topic", "partition"})
+
+	batchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_size",
+		Help:      "Number of items in a batch by stage.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"stage"})
+
+	renderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "render_duration_seconds",
+		Help:      "Receipt rendering latency by format.",
+		Buckets:   prometheus.ExponentialBuckets(0.00005, 2, 12),
+	}, []string{"format"})
+
+	deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_deliveries_total",
+		Help:      "Number of mail delivery attempts by outcome.",
+	}, []string{"outcome"})
+
+	deadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_letters_total",
+		Help:      "Number of records produced to the dead letter topic.",
+	}, []string{"topic"})
+
+	pausedSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_paused_seconds_total",
+		Help:      "Time the partitions were paused by topic.",
+	}, []string{"topic"})
+)
+
+// Handler serves the metrics of the default registry.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Register registers "GET /metrics".
+func Register(mux *http.ServeMux) {
+	mux.Handle("GET /metrics", Handler())
+}
+
+// InstrumentHTTP observes the requests. The route label is the pattern of
+// the routes mux matching the request, so the path parameters do not blow up
+// the label cardinality.
+func InstrumentHTTP(routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := "unmatched"
+		if _, pattern := routes.Handler(r); pattern != "" {
+			route = pattern
+		}
+
+		sw := httpserver.NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+
+		status := strconv.Itoa(sw.Status())
+		httpRequests.WithLabelValues(route, status).Inc()
+		httpDuration.WithLabelValues(route, status).Observe(
+			time.Since(start).Seconds())
+	})
+}
+
+// ObserveProduce records the latency and the result of a produced record.
+func ObserveProduce(topic string, start time.Time, err error) {
+	result := ResultOK
+	if err != nil {
+		result = ResultError
+		produceErrors.WithLabelValues(topic).Inc()
+	}
+	produceDuration.WithLabelValues(topic, result).Observe(
+		time.Since(start).Seconds())
+}
+
+func SetConsumerLag(topic string, partition int32, lag int64) {
+	consumerLag.WithLabelValues(
+		topic, strconv.Itoa(int(partition))).Set(float64(max(lag, 0)))
+}
+
+func DeleteConsumerLag(topic string, partition int32) {
+	consumerLag.DeleteLabelValues(topic, strconv.Itoa(int(partition)))
+}
+
+// SetGroupLag sets the committed lag of the consumer group.
+func SetGroupLag(group string, topic string, partition int32, lag int64) {
+	groupLag.WithLabelValues(
+		group, topic, strconv.Itoa(int(partition))).Set(float64(max(lag, 0)))
+}
+
+// SetOldestRecordAge sets the age of the oldest unprocessed record of the
+// consumer group.
+func SetOldestRecordAge(
+	group string, topic string, partition int32, age time.Duration,
+) {
+	p := strconv.Itoa(int(partition))
+	oldestRecordAge.WithLabelValues(group, topic, p).Set(age.Seconds())
+	oldestRecordAgeUnknown.WithLabelValues(group, topic, p).Set(0)
+}
+
+// SetOldestRecordAgeUnknown flags the age of the oldest unprocessed record
+// as unknown, the last observed age is kept.
+func SetOldestRecordAgeUnknown(group string, topic string, partition int32) {
+	oldestRecordAgeUnknown.WithLabelValues(
+		group, topic, strconv.Itoa(int(partition))).Set(1)
+}
+
+func ObserveBatchSize(stage string, n int) {
+	batchSize.WithLabelValues(stage).Observe(float64(n))
+}
+
+func ObserveRender(format string, d time.Duration) {
+	renderDuration.WithLabelValues(format).Observe(d.Seconds())
+}
+
+func IncDelivery(outcome string) {
+	deliveries.WithLabelValues(outcome).Inc()
+}
+
+func IncDeadLetter(topic string) {
+	deadLetters.WithLabelValues(topic).Inc()
+}
+
+func AddPaused(topic string, d time.Duration) {
+	pausedSeconds.WithLabelValues(topic).Add(d.Seconds())
+}
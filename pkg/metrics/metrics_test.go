@@ -0,0 +1,33 @@
+//go:build !integration
+
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentHTTP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/receipt/{uuid}/status",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+	handler := metrics.InstrumentHTTP(mux, mux)
+
+	for _, path := range []string{"/v1/receipt/a/status", "/v1/receipt/b/status"} {
+		handler.ServeHTTP(
+			httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(
+		rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Contains(t, rec.Body.String(),
+		`receipt_http_requests_total{route="GET /v1/receipt/{uuid}/status",status="404"} 2`)
+}
@@ -1,17 +1,38 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/requestid"
 )
 
-func AcceptJSON(next http.Handler) http.Handler {
+const (
+	mediaTypeJSON   = "application/json"
+	mediaTypeNDJSON = "application/x-ndjson"
+)
+
+// AcceptJSON rejects the request bodies other than JSON. NDJSON is accepted
+// on the ndjsonPaths only.
+func AcceptJSON(next http.Handler, ndjsonPaths ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Content-Type") != "application/json" {
-			w.Header().Set("Accept", "application/json")
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mediaTypes := []string{mediaTypeJSON}
+		if slices.Contains(ndjsonPaths, r.URL.Path) {
+			mediaTypes = append(mediaTypes, mediaTypeNDJSON)
+		}
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || !slices.Contains(mediaTypes, mediaType) {
+			w.Header().Set("Accept", strings.Join(mediaTypes, ", "))
 			errStr := "invalid media type"
 			http.Error(w, errStr, http.StatusUnsupportedMediaType)
 			return
@@ -20,6 +41,40 @@ func AcceptJSON(next http.Handler) http.Handler {
 	})
 }
 
+// BearerAuth rejects the requests without the "Authorization: Bearer" header
+// carrying the token.
+func BearerAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestID continues the request ID from the "X-Request-ID" header or
+// generates a new one. The ID is written to the response headers, and the
+// logger enriched with it is stored in the request context.
+func RequestID(l logger.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.HeaderName)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.HeaderName, id)
+
+		ctx := requestid.NewContext(r.Context(), id)
+		ctx = logger.NewContext(
+			ctx, logger.Logger{Logger: l.With().Str("requestID", id).Logger()})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LogResposeStatus writes the access log with the request scoped logger, so
+// the fields added by the handlers, e.g. the receipt UUID, are included.
 func LogResposeStatus(l logger.Logger, next http.Handler) http.Handler {
 	return httpLog{l, next}
 }
@@ -47,6 +102,8 @@ func (l httpLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	resDurStrMicro := strconv.FormatInt(procDur.Microseconds(), 10) + "μs"
 	statusCode := wrapper.statusCode
 
-	l.log.Info().Str(
+	log := l.log.Ctx(r.Context())
+	log.Info().Str("method", r.Method).Str(
+		"path", r.URL.Path).Str("remoteAddr", r.RemoteAddr).Str(
 		"responseDuration", resDurStrMicro).Int("status", statusCode).Send()
 }
@@ -0,0 +1,94 @@
+//go:build !integration
+
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/logger"
+	"github.com/niksmo/receipt/pkg/middleware"
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptJSON(t *testing.T) {
+	handler := middleware.AcceptJSON(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		"/batch")
+
+	tests := []struct {
+		path        string
+		contentType string
+		status      int
+	}{
+		{"/single", "application/json", http.StatusOK},
+		{"/single", "application/x-ndjson", http.StatusUnsupportedMediaType},
+		{"/single", "application/json; charset=utf-8", http.StatusOK},
+		{"/batch", "application/x-ndjson", http.StatusOK},
+		{"/batch", "Application/X-NDJSON; charset=utf-8", http.StatusOK},
+		{"/batch", "", http.StatusUnsupportedMediaType},
+		{"/batch", "text/plain", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		req.Header.Set("Content-Type", tt.contentType)
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, tt.path+" "+tt.contentType)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	handler := middleware.BearerAuth("secret",
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	tests := []struct {
+		authorization string
+		status        int
+	}{
+		{"Bearer secret", http.StatusOK},
+		{"Bearer other", http.StatusUnauthorized},
+		{"Basic secret", http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, tt.authorization)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var got string
+	handler := middleware.RequestID(logger.New("disabled"),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = requestid.FromContext(r.Context())
+		}))
+
+	t.Run("honor_incoming", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestid.HeaderName, "req-42")
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, "req-42", got)
+		assert.Equal(t, "req-42", rec.Header().Get(requestid.HeaderName))
+	})
+
+	t.Run("generate", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestid.HeaderName, "bad id\n")
+		handler.ServeHTTP(rec, req)
+
+		assert.NotEqual(t, "bad id\n", got)
+		assert.True(t, requestid.Valid(got))
+		assert.Equal(t, got, rec.Header().Get(requestid.HeaderName))
+	})
+}
@@ -0,0 +1,53 @@
+// Package outbox is the wire contract of the mail outbox topic the receipt
+// service produces and the mail dispatcher consumes.
+package outbox
+
+import (
+	"fmt"
+
+	"github.com/niksmo/receipt/pkg/fieldcrypt"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// The names of the encrypted fields in the record headers.
+const (
+	FieldTo   = "to"
+	FieldText = "text"
+	FieldHTML = "html"
+)
+
+// MailV1 is the rendered receipt mail.
+type MailV1 struct {
+	ReceiptUUID string `json:"receipt_uuid"`
+	To          string `json:"to"`
+	Subject     string `json:"subject"`
+	Text        string `json:"text"`
+	HTML        string `json:"html"`
+}
+
+// Encrypt encrypts the recipient and the mail body, they carry the customer
+// contacts. The returned headers must be added to the record.
+func (m *MailV1) Encrypt(kr *fieldcrypt.Keyring) ([]kgo.RecordHeader, error) {
+	const op = "MailV1.Encrypt"
+
+	env, err := kr.Encrypt(m.ReceiptUUID, &m.To, &m.Text, &m.HTML)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return fieldcrypt.RecordHeaders(env, FieldTo, FieldText, FieldHTML), nil
+}
+
+// Decrypt decrypts the fields listed in the record headers, if any.
+func (m *MailV1) Decrypt(kr *fieldcrypt.Keyring, rec *kgo.Record) error {
+	const op = "MailV1.Decrypt"
+
+	err := fieldcrypt.DecryptRecord(kr, rec, m.ReceiptUUID, map[string]*string{
+		FieldTo:   &m.To,
+		FieldText: &m.Text,
+		FieldHTML: &m.HTML,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
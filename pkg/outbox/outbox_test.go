@@ -0,0 +1,31 @@
+//go:build !integration
+
+package outbox_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailV1(t *testing.T) {
+	const wire = `{"receipt_uuid":"a","to":"john@example.com",` +
+		`"subject":"Receipt","text":"text","html":"<p>html</p>"}`
+
+	var m outbox.MailV1
+	require.NoError(t, json.Unmarshal([]byte(wire), &m))
+	assert.Equal(t, outbox.MailV1{
+		ReceiptUUID: "a",
+		To:          "john@example.com",
+		Subject:     "Receipt",
+		Text:        "text",
+		HTML:        "<p>html</p>",
+	}, m)
+
+	b, err := json.Marshal(m)
+	require.NoError(t, err)
+	assert.JSONEq(t, wire, string(b))
+}
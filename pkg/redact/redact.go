@@ -0,0 +1,93 @@
+// Package redact masks the personal data of customers: emails, phones and
+// taxpayer numbers (INN).
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+const mask = "***"
+
+// Rule masks a field value.
+type Rule func(string) string
+
+// FieldRules are the masking rules of the known receipt fields by the names
+// they are logged and encoded with.
+var FieldRules = map[string]Rule{
+	"to":              Email,
+	"email":           Email,
+	"customerEmail":   Email,
+	"customer_email":  Email,
+	"CustomerEmail":   Email,
+	"phone":           Phone,
+	"inn":             INN,
+	"taxpayerNumber":  INN,
+	"taxpayer_number": INN,
+	"TaxpayerNumber":  INN,
+}
+
+var (
+	emailRe = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// phoneRe matches the international numbers and the Russian ones
+	// dialed with the leading 8, the digit groups may be separated.
+	phoneRe = regexp.MustCompile(
+		`(?:\+\d{1,3}|\b8)[\s(\-]*\d{3}[\s)\-]*\d{3}[\s\-]*\d{2}[\s\-]*\d{2}\b`)
+	// innRe matches the taxpayer numbers of companies and individuals.
+	innRe = regexp.MustCompile(`\b(?:\d{10}|\d{12})\b`)
+)
+
+// Email keeps the first character of the local part and the domain, e.g.
+// "j***@example.com".
+func Email(s string) string {
+	local, domain, ok := strings.Cut(s, "@")
+	if !ok || local == "" {
+		return mask
+	}
+	return local[:1] + mask + "@" + domain
+}
+
+// Phone keeps the last two digits.
+func Phone(s string) string {
+	return keepLastDigits(s, 2)
+}
+
+// INN keeps the last four digits.
+func INN(s string) string {
+	return keepLastDigits(s, 4)
+}
+
+// All masks the value entirely.
+func All(string) string {
+	return mask
+}
+
+// Text masks the emails, phones and INNs found in the free text, e.g. error
+// messages and rendered mails.
+func Text(s string) string {
+	s = emailRe.ReplaceAllStringFunc(s, Email)
+	s = phoneRe.ReplaceAllStringFunc(s, Phone)
+	return innRe.ReplaceAllStringFunc(s, INN)
+}
+
+func keepLastDigits(s string, n int) string {
+	var digits int
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			if digits > n {
+				r = '*'
+			}
+			digits--
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
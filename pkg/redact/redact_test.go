@@ -0,0 +1,39 @@
+//go:build !integration
+
+package redact_test
+
+import (
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRules(t *testing.T) {
+	assert.Equal(t, "j***@example.com", redact.Email("john.doe@example.com"))
+	assert.Equal(t, "***", redact.Email("not an email"))
+	assert.Equal(t, "+* *** ***-**-67", redact.Phone("+7 999 123-45-67"))
+	assert.Equal(t, "******3893", redact.INN("7707083893"))
+	assert.Equal(t, "***", redact.All("Moscow"))
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{
+			"failed to send to john.doe@example.com: rejected",
+			"failed to send to j***@example.com: rejected",
+		},
+		{"call +7 999 123-45-67", "call +* *** ***-**-67"},
+		{"call 89991234567 now", "call *********67 now"},
+		{"inn 7707083893, 500100732259", "inn ******3893, ********2259"},
+		{"offset 12345, 3 records", "offset 12345, 3 records"},
+	}
+	for _, tt := range tests {
+		got := redact.Text(tt.text)
+		assert.Equal(t, tt.want, got)
+		assert.Equal(t, got, redact.Text(got))
+	}
+}
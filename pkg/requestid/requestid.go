@@ -0,0 +1,47 @@
+// Package requestid carries the request ID across the HTTP requests and
+// Kafka records handled on behalf of a client request.
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderName = "X-Request-ID"
+	// RecordHeader is the Kafka record header carrying the request ID.
+	RecordHeader = "request-id"
+
+	maxLen = 128
+)
+
+type ctxKey struct{}
+
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether the incoming request ID is accepted as is. The ID is
+// written to logs and headers, so only printable ASCII is allowed.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
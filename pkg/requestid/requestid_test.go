@@ -0,0 +1,43 @@
+//go:build !integration
+
+package requestid_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	tests := map[string]bool{
+		"":                       false,
+		"abc-123":                true,
+		"a~!":                    true,
+		strings.Repeat("a", 128): true,
+		strings.Repeat("a", 129): false,
+		"with space":             false,
+		"line\nbreak":            false,
+		"tab\t":                  false,
+		"unicode-ид":             false,
+		"\x7f":                   false,
+	}
+	for id, valid := range tests {
+		assert.Equal(t, valid, requestid.Valid(id), "%q", id)
+	}
+}
+
+func TestNew(t *testing.T) {
+	a, b := requestid.New(), requestid.New()
+	assert.True(t, requestid.Valid(a))
+	assert.NotEqual(t, a, b)
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Empty(t, requestid.FromContext(context.Background()))
+
+	ctx := requestid.NewContext(context.Background(), "abc-123")
+	assert.Equal(t, "abc-123", requestid.FromContext(ctx))
+}
@@ -0,0 +1,124 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	contentType    = "application/vnd.schemaregistry.v1+json"
+	requestTimeout = 5 * time.Second
+)
+
+var _ Registry = (*HTTPRegistry)(nil)
+
+// HTTPRegistry is a client of the Confluent schema registry REST API.
+type HTTPRegistry struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPRegistry(baseURL string) *HTTPRegistry {
+	return &HTTPRegistry{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+type schemaPayload struct {
+	Schema     string     `json:"schema"`
+	SchemaType SchemaType `json:"schemaType,omitempty"`
+}
+
+type registerResponse struct {
+	ID int `json:"id"`
+}
+
+type errorResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+func (r *HTTPRegistry) Register(
+	ctx context.Context, subject string, s Schema,
+) (int, error) {
+	const op = "HTTPRegistry.Register"
+
+	req := schemaPayload{Schema: s.Schema}
+	if s.Type != TypeAvro {
+		req.SchemaType = s.Type
+	}
+
+	var res registerResponse
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := r.do(ctx, http.MethodPost, path, req, &res); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return res.ID, nil
+}
+
+func (r *HTTPRegistry) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	const op = "HTTPRegistry.SchemaByID"
+
+	var res schemaPayload
+	path := "/schemas/ids/" + strconv.Itoa(id)
+	if err := r.do(ctx, http.MethodGet, path, nil, &res); err != nil {
+		return Schema{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s := Schema{Type: res.SchemaType, Schema: res.Schema}
+	if s.Type == "" {
+		s.Type = TypeAvro
+	}
+	return s, nil
+}
+
+func (r *HTTPRegistry) do(
+	ctx context.Context, method string, path string, in any, out any,
+) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		var e errorResponse
+		_ = json.NewDecoder(res.Body).Decode(&e)
+		return fmt.Errorf(
+			"unexpected status %d: code %d: %s",
+			res.StatusCode, e.ErrorCode, e.Message,
+		)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,63 @@
+package schemaregistry
+
+import (
+	"context"
+	"sync"
+)
+
+var _ Registry = (*MemoryRegistry)(nil)
+
+// MemoryRegistry is an in-process registry. It stands in for a real registry
+// in tests and local runs, where producer and consumer share the instance.
+type MemoryRegistry struct {
+	mu       sync.RWMutex
+	schemas  []Schema
+	subjects map[string]map[Schema]int
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{subjects: make(map[string]map[Schema]int)}
+}
+
+func (r *MemoryRegistry) Register(
+	_ context.Context, subject string, s Schema,
+) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id, ok := r.subjects[subject][s]; ok {
+		return id, nil
+	}
+
+	id := r.schemaID(s)
+	if id == 0 {
+		r.schemas = append(r.schemas, s)
+		id = len(r.schemas)
+	}
+
+	if r.subjects[subject] == nil {
+		r.subjects[subject] = make(map[Schema]int)
+	}
+	r.subjects[subject][s] = id
+	return id, nil
+}
+
+func (r *MemoryRegistry) SchemaByID(_ context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if id < 1 || id > len(r.schemas) {
+		return Schema{}, ErrNotFound
+	}
+	return r.schemas[id-1], nil
+}
+
+// schemaID returns the ID of the schema registered under any subject or 0.
+func (r *MemoryRegistry) schemaID(s Schema) int {
+	for i, registered := range r.schemas {
+		if registered == s {
+			return i + 1
+		}
+	}
+	return 0
+}
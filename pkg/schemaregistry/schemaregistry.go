@@ -0,0 +1,38 @@
+// Package schemaregistry implements a client of Confluent compatible schema
+// registries and the wire format of the registered records.
+package schemaregistry
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNotFound = errors.New("schema not found")
+
+type SchemaType string
+
+const (
+	TypeAvro     SchemaType = "AVRO"
+	TypeJSON     SchemaType = "JSON"
+	TypeProtobuf SchemaType = "PROTOBUF"
+)
+
+type Schema struct {
+	Type   SchemaType
+	Schema string
+}
+
+type Registry interface {
+	// Register registers the schema under the subject and returns its ID.
+	// Registering the same schema again returns the existing ID.
+	Register(ctx context.Context, subject string, s Schema) (int, error)
+
+	// SchemaByID returns the schema or ErrNotFound.
+	SchemaByID(ctx context.Context, id int) (Schema, error)
+}
+
+// TopicSubject returns the subject of the record values by the default
+// TopicNameStrategy.
+func TopicSubject(topic string) string {
+	return topic + "-value"
+}
@@ -0,0 +1,116 @@
+//go:build !integration
+
+package schemaregistry_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/schemaregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = schemaregistry.Schema{
+	Type:   schemaregistry.TypeJSON,
+	Schema: `{"type":"object"}`,
+}
+
+func TestWireFormat(t *testing.T) {
+	t.Run("header", func(t *testing.T) {
+		b := schemaregistry.AppendHeader(nil, 42)
+		b = append(b, "payload"...)
+		assert.Equal(t, []byte{0, 0, 0, 0, 42}, b[:5])
+
+		id, payload, err := schemaregistry.ParseHeader(b)
+		require.NoError(t, err)
+		assert.Equal(t, 42, id)
+		assert.Equal(t, "payload", string(payload))
+	})
+
+	t.Run("not_framed", func(t *testing.T) {
+		_, _, err := schemaregistry.ParseHeader([]byte(`{"a":1}`))
+		assert.ErrorIs(t, err, schemaregistry.ErrInvalidFrame)
+	})
+
+	t.Run("message_indexes", func(t *testing.T) {
+		for _, indexes := range [][]int{{0}, {1}, {2, 0, 3}} {
+			b := schemaregistry.AppendMessageIndexes(nil, indexes...)
+			b = append(b, "payload"...)
+
+			actual, payload, err := schemaregistry.ParseMessageIndexes(b)
+			require.NoError(t, err)
+			assert.Equal(t, indexes, actual)
+			assert.Equal(t, "payload", string(payload))
+		}
+		assert.Equal(t, []byte{0}, schemaregistry.AppendMessageIndexes(nil, 0))
+	})
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	testRegistry(t, schemaregistry.NewMemoryRegistry())
+}
+
+func TestHTTPRegistry(t *testing.T) {
+	srv := httptest.NewServer(fakeServer(schemaregistry.NewMemoryRegistry()))
+	defer srv.Close()
+
+	testRegistry(t, schemaregistry.NewHTTPRegistry(srv.URL))
+}
+
+func testRegistry(t *testing.T, r schemaregistry.Registry) {
+	ctx := context.Background()
+
+	id, err := r.Register(ctx, "receipt-value", testSchema)
+	require.NoError(t, err)
+
+	again, err := r.Register(ctx, "receipt-value", testSchema)
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	s, err := r.SchemaByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, testSchema, s)
+
+	_, err = r.SchemaByID(ctx, id+100)
+	assert.ErrorIs(t, err, schemaregistry.ErrNotFound)
+}
+
+// fakeServer serves the subset of the registry REST API used by the client.
+func fakeServer(r *schemaregistry.MemoryRegistry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /subjects/{subject}/versions",
+		func(w http.ResponseWriter, req *http.Request) {
+			var body struct {
+				Schema     string                    `json:"schema"`
+				SchemaType schemaregistry.SchemaType `json:"schemaType"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			id, _ := r.Register(req.Context(), req.PathValue("subject"),
+				schemaregistry.Schema{Type: body.SchemaType, Schema: body.Schema})
+			_ = json.NewEncoder(w).Encode(map[string]int{"id": id})
+		})
+	mux.HandleFunc("GET /schemas/ids/{id}",
+		func(w http.ResponseWriter, req *http.Request) {
+			id, _ := strconv.Atoi(req.PathValue("id"))
+			s, err := r.SchemaByID(req.Context(), id)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"error_code": 40403, "message": "Schema not found",
+				})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"schema": s.Schema, "schemaType": s.Type,
+			})
+		})
+	return mux
+}
@@ -0,0 +1,70 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	magicByte  = 0
+	headerSize = 5
+)
+
+var ErrInvalidFrame = errors.New("invalid schema registry wire format")
+
+// AppendHeader appends the magic byte and the schema ID.
+func AppendHeader(dst []byte, id int) []byte {
+	dst = append(dst, magicByte)
+	return binary.BigEndian.AppendUint32(dst, uint32(id))
+}
+
+// IsFramed reports whether b starts with the wire format header.
+func IsFramed(b []byte) bool {
+	return len(b) >= headerSize && b[0] == magicByte
+}
+
+// ParseHeader returns the schema ID and the rest of b.
+func ParseHeader(b []byte) (int, []byte, error) {
+	if !IsFramed(b) {
+		return 0, nil, ErrInvalidFrame
+	}
+	id := binary.BigEndian.Uint32(b[1:headerSize])
+	return int(id), b[headerSize:], nil
+}
+
+// AppendMessageIndexes appends the protobuf message indexes, the path to the
+// message type within the schema file. The common case of the first message
+// is written as a single zero byte.
+func AppendMessageIndexes(dst []byte, indexes ...int) []byte {
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return append(dst, 0)
+	}
+	dst = binary.AppendVarint(dst, int64(len(indexes)))
+	for _, idx := range indexes {
+		dst = binary.AppendVarint(dst, int64(idx))
+	}
+	return dst
+}
+
+// ParseMessageIndexes returns the protobuf message indexes and the rest of b.
+func ParseMessageIndexes(b []byte) ([]int, []byte, error) {
+	n, size := binary.Varint(b)
+	if size <= 0 || n < 0 || n > int64(len(b)) {
+		return nil, nil, ErrInvalidFrame
+	}
+	b = b[size:]
+	if n == 0 {
+		return []int{0}, b, nil
+	}
+
+	indexes := make([]int, 0, n)
+	for range n {
+		idx, size := binary.Varint(b)
+		if size <= 0 {
+			return nil, nil, ErrInvalidFrame
+		}
+		indexes = append(indexes, int(idx))
+		b = b[size:]
+	}
+	return indexes, b, nil
+}
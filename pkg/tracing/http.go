@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/niksmo/receipt/pkg/httpserver"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts the server span continuing the trace of the incoming
+// request. The span is named by the pattern of the routes mux matching the
+// request, and its trace context is written to the response headers.
+func Middleware(routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := r.Method
+		if _, pattern := routes.Handler(r); pattern != "" {
+			route = pattern
+		}
+		ctx, span := Start(ctx, route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		Inject(ctx, propagation.HeaderCarrier(w.Header()))
+		sw := httpserver.NewStatusWriter(w)
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", sw.Status()))
+		if sw.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.Status()))
+		}
+	})
+}
+
+// InjectHTTP writes the trace context to the outgoing request headers.
+func InjectHTTP(r *http.Request) {
+	Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var _ propagation.TextMapCarrier = RecordCarrier{}
+
+// RecordCarrier carries the trace context in the Kafka record headers.
+type RecordCarrier struct {
+	Record *kgo.Record
+}
+
+func (c RecordCarrier) Get(key string) string {
+	for _, h := range c.Record.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c RecordCarrier) Set(key string, value string) {
+	for i, h := range c.Record.Headers {
+		if h.Key == key {
+			c.Record.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.Record.Headers = append(
+		c.Record.Headers, kgo.RecordHeader{Key: key, Value: []byte(value)})
+}
+
+func (c RecordCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.Record.Headers))
+	for _, h := range c.Record.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -0,0 +1,123 @@
+// Package tracing sets up OpenTelemetry tracing and propagates the W3C trace
+// context over HTTP and Kafka record headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/niksmo/receipt/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/niksmo/receipt"
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	// ExporterOTLP exports over OTLP/HTTP, the endpoint is configured with
+	// the standard OTEL_EXPORTER_OTLP_ENDPOINT variable.
+	ExporterOTLP = "otlp"
+)
+
+// Setup installs the tracer provider with the named exporter. The spans are
+// created even if the exporter is none, so the trace context is propagated
+// and logged anyway. The returned function flushes and stops the provider.
+func Setup(
+	ctx context.Context, serviceName string, exporter string,
+) (func(context.Context) error, error) {
+	const op = "tracing.Setup"
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterStdout:
+		exp, err = stdouttrace.New()
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	case ExporterNone, "":
+	default:
+		err = fmt.Errorf("unsupported exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var opts []sdktrace.TracerProviderOption
+	if exp != nil {
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+	tp := Install(serviceName, opts...)
+	return tp.Shutdown, nil
+}
+
+// Flush flushes and stops the provider set up by Setup until the context is
+// done. The spans are best effort, so the failure is only logged.
+func Flush(
+	ctx context.Context, log logger.Logger, shutdown func(context.Context) error,
+) {
+	if err := shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to flush traces")
+	}
+}
+
+// Install installs the tracer provider and the W3C trace context propagator
+// globally. Tests pass sdktrace.WithSyncer with the in-memory exporter.
+func Install(
+	serviceName string, opts ...sdktrace.TracerProviderOption,
+) *sdktrace.TracerProvider {
+	res := resource.NewSchemaless(
+		attribute.String("service.name", serviceName))
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+	}, opts...)
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	return tp
+}
+
+func Start(
+	ctx context.Context, name string, opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+func Extract(
+	ctx context.Context, carrier propagation.TextMapCarrier,
+) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// TraceID returns the trace ID of the context span for logging.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
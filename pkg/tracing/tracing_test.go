@@ -0,0 +1,60 @@
+//go:build !integration
+
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/niksmo/receipt/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tracing.Install("test", sdktrace.WithSyncer(exp))
+
+	mux := http.NewServeMux()
+	var traceID string
+	mux.HandleFunc("POST /v1/receipts", func(w http.ResponseWriter, r *http.Request) {
+		traceID = tracing.TraceID(r.Context())
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/receipts", nil)
+	req.Header.Set("traceparent",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tracing.Middleware(mux, mux).ServeHTTP(rec, req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Contains(t, rec.Header().Get("traceparent"), traceID)
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "POST /v1/receipts", spans[0].Name)
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+}
+
+func TestRecordCarrier(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tracing.Install("test", sdktrace.WithSyncer(exp))
+
+	ctx, span := tracing.Start(context.Background(), "publish")
+	rec := &kgo.Record{Headers: []kgo.RecordHeader{{Key: "content-type"}}}
+	tracing.Inject(ctx, tracing.RecordCarrier{Record: rec})
+	span.End()
+
+	got := tracing.Extract(
+		context.Background(), tracing.RecordCarrier{Record: rec})
+	assert.Equal(t, tracing.TraceID(ctx), tracing.TraceID(got))
+	assert.Len(t, rec.Headers, 2)
+}